@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/internal/asm"
+	"github.com/spf13/cobra"
+)
+
+func newAsmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "asm PATH_TO_SOURCE_FILE",
+		Short: "Assemble a ROM",
+		Long: "Assemble a ROM.\n" +
+			"The source uses the mnemonics printed by the disassembler, " +
+			"so a disassembly listing can be edited and assembled back.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	output := cmd.Flags().StringP("output", "o", "", "path to the ROM file, defaults to the source path with .ch8 extension")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+		path := args[0]
+		bs, err := asm.Assemble(path)
+		if err != nil {
+			return err
+		}
+
+		out := *output
+		if out == "" {
+			out = strings.TrimSuffix(path, filepath.Ext(path)) + ".ch8"
+		}
+
+		if err = os.WriteFile(out, bs, 0o644); err != nil {
+			return fmt.Errorf("unable to write file %q: %w", out, err)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+	"github.com/spf13/cobra"
+)
+
+func newBenchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench PATH_TO_ROM_FILE...",
+		Short: "Measure the speed of the interpreter",
+		Long: "Measure the speed of the interpreter.\n" +
+			"Each ROM is run headlessly as fast as possible without any input, " +
+			"ROMs that stop by themselves are skipped as they don't run all the instructions.",
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	machineFlags := newMachineFlags(cmd.Flags())
+
+	frames := cmd.Flags().Int("frames", 6000, "number of frames to run each ROM for (60 frames per second)")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *frames <= 0 {
+			return errors.New("--frames must be positive")
+		}
+
+		var (
+			total   int
+			elapsed time.Duration
+		)
+
+		fmt.Printf("%-20s %14s %10s %16s\n", "ROM", "Instructions", "Time", "Instructions/s")
+		for _, path := range args {
+			rom, err := machineFlags.loadROM(path)
+			if err != nil {
+				return err
+			}
+
+			config, err := machineFlags.config(rom)
+			if err != nil {
+				return err
+			}
+			if config.CyclesPerFrame <= 0 {
+				config.CyclesPerFrame = vm.DefaultCyclesPerFrame
+			}
+
+			machine := vm.New(rom.data, vm.WithConfig(config))
+			h := headless.New(headless.Options{Frames: *frames})
+
+			start := time.Now()
+			if err = machine.Run(cmd.Context(), vm.NewHAL(h)); !errors.Is(err, headless.ErrDone) {
+				return fmt.Errorf("%s: vm stopped at frame %d: %w", path, h.Frame(), err)
+			}
+			d := time.Since(start)
+
+			name := filepath.Base(path)
+			if machine.Snapshot().Halted {
+				fmt.Printf("%-20s program stopped, skipped\n", name)
+				continue
+			}
+
+			n := *frames * config.CyclesPerFrame
+			total += n
+			elapsed += d
+			fmt.Printf("%-20s %14d %9.3fs %16.0f\n", name, n, d.Seconds(), float64(n)/d.Seconds())
+		}
+
+		if elapsed > 0 {
+			fmt.Printf("%-20s %14d %9.3fs %16.0f\n", "total", total, elapsed.Seconds(), float64(total)/elapsed.Seconds())
+		}
+
+		return nil
+	}
+
+	return cmd
+}
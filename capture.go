@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/internal/capture"
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+	"github.com/spf13/cobra"
+)
+
+func newCaptureCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capture PATH_TO_ROM_FILE",
+		Short: "Capture the screen of a ROM to an animated GIF or a PNG image",
+		Long: "Capture the screen of a ROM to an animated GIF or a PNG image.\n" +
+			"The ROM is run without a window for a number of frames, a GIF records every frame, " +
+			"a PNG only the last one.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	machineFlags := newMachineFlags(cmd.Flags())
+
+	frames := cmd.Flags().Int("frames", 600, "number of frames to run (60 frames per second)")
+	output := cmd.Flags().StringP("out", "o", "", "path to the .gif or .png file")
+	scale := cmd.Flags().Int("scale", capture.DefaultScale, "size of a high resolution pixel, low resolution pixels are twice as big")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		isGIF := strings.EqualFold(filepath.Ext(*output), ".gif")
+		if !isGIF && !strings.EqualFold(filepath.Ext(*output), ".png") {
+			return errors.New("--out must be a .gif or a .png file")
+		}
+
+		if *frames <= 0 {
+			return errors.New("--frames must be positive")
+		}
+
+		rom, err := machineFlags.loadROM(args[0])
+		if err != nil {
+			return err
+		}
+
+		config, err := machineFlags.config(rom)
+		if err != nil {
+			return err
+		}
+
+		machine := vm.New(rom.data, vm.WithConfig(config))
+
+		h := headless.New(headless.Options{Frames: *frames})
+		devices := vm.NewHAL(h)
+
+		var recording *capture.GIF
+		if isGIF {
+			recording = capture.NewGIF(rom.palette, *scale, devices.Display, devices.Clock)
+			devices.Display = recording
+			devices.Clock = recording
+		}
+
+		if err = machine.Run(cmd.Context(), devices); !errors.Is(err, headless.ErrDone) {
+			return fmt.Errorf("vm stopped at frame %d: %w", h.Frame(), err)
+		}
+
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("unable to create file %q: %w", *output, err)
+		}
+		defer f.Close()
+
+		if isGIF {
+			err = recording.Encode(f)
+		} else {
+			err = capture.WritePNG(f, machine.Framebuffer(), rom.palette, *scale)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write file %q: %w", *output, err)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// crashScreen is implemented by frontends that can show a crashed program
+// report. ShowCrash returns hal.ErrReboot to reset the VM or hal.ErrQuit.
+type crashScreen interface {
+	ShowCrash(lines []string) error
+}
+
+// crashError is returned when the VM stops with an error, the report
+// describes the state of the VM at the moment.
+type crashError struct {
+	err    error
+	report []string
+}
+
+func newCrashError(machine *vm.VM, err error) *crashError {
+	pc := machine.PC()
+	opcode := machine.Opcode(pc)
+
+	var fault *vm.Fault
+	if errors.As(err, &fault) {
+		pc, opcode = fault.PC, fault.Opcode
+	}
+
+	report := []string{
+		fmt.Sprintf("pc=0x%04x  opcode=0x%04x (%s)", pc, opcode, vm.Disassemble(opcode)),
+		fmt.Sprintf("i=0x%04x  sp=%d  dt=%d  st=%d", machine.Index(), machine.SP(), machine.DelayTimer(), machine.SoundTimer()),
+	}
+
+	registers := machine.Registers()
+	for i := 0; i < len(registers); i += 8 {
+		var line []string
+		for j := i; j < i+8; j++ {
+			line = append(line, fmt.Sprintf("v%x=0x%02x", j, registers[j]))
+		}
+		report = append(report, strings.Join(line, "  "))
+	}
+
+	line := "stack:"
+	for _, addr := range machine.Stack() {
+		line += fmt.Sprintf(" 0x%04x", addr)
+	}
+	report = append(report, line)
+
+	return &crashError{err: err, report: report}
+}
+
+func (e *crashError) Error() string {
+	return fmt.Sprintf("program crashed: %v", e.err)
+}
+
+func (e *crashError) Unwrap() error {
+	return e.err
+}
+
+// lines returns the error followed by the report.
+func (e *crashError) lines() []string {
+	return append([]string{e.Error(), ""}, e.report...)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kapitanov/chip8vm/internal/debugger"
+	"github.com/kapitanov/chip8vm/internal/hal"
+	"github.com/kapitanov/chip8vm/vm"
+	"github.com/spf13/cobra"
+)
+
+func newDebugCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug PATH_TO_ROM_FILE",
+		Short: "Run emulator under an interactive debugger",
+		Long: "Run emulator under an interactive debugger.\n" +
+			"The debugger reads commands from stdin, type \"help\" for the list of commands.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	machineFlags := newMachineFlags(cmd.Flags())
+	frontendFlags := newFrontendFlags(cmd.Flags())
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *frontendFlags.name == terminalFrontend {
+			if cmd.Flags().Changed("frontend") {
+				return fmt.Errorf("the debugger reads commands from the terminal, it can't be used with the terminal frontend, use --frontend %s", nullFrontend)
+			}
+
+			// Built without SDL, run the program without a screen
+			*frontendFlags.name = nullFrontend
+		}
+
+		rom, err := machineFlags.loadROM(args[0])
+		if err != nil {
+			return err
+		}
+
+		config, err := machineFlags.config(rom)
+		if err != nil {
+			return err
+		}
+
+		machine := vm.New(rom.data, vm.WithConfig(config))
+
+		h, err := frontendFlags.newFrontend(rom, hal.Options{Palette: rom.palette})
+		if err != nil {
+			return err
+		}
+		defer h.Shutdown()
+
+		d := debugger.New(machine, os.Stdin, os.Stdout)
+		for {
+			machine.Reset()
+			err = d.Run(vm.NewHAL(h))
+
+			if errors.Is(err, hal.ErrReboot) {
+				continue
+			}
+
+			if errors.Is(err, hal.ErrQuit) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/kapitanov/chip8vm/internal/disasm"
+	"github.com/spf13/cobra"
+)
+
+func newDisasmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disasm PATH_TO_ROM_FILE",
+		Short: "Disassemble a ROM",
+		Long: "Disassemble a ROM.\n" +
+			"Instructions are found by following jumps, subroutine calls and skips from the entry point, " +
+			"everything else is printed as data bytes.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	output := cmd.Flags().StringP("output", "o", "", "write disassembly to a file instead of stdout")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+		path := args[0]
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to load file %q: %w", path, err)
+		}
+
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return fmt.Errorf("unable to create file %q: %w", *output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if _, err = fmt.Fprintf(w, "; %s, %d bytes\n", filepath.Base(path), len(bs)); err != nil {
+			return err
+		}
+
+		return disasm.Write(w, disasm.Disassemble(bs))
+	}
+
+	return cmd
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kapitanov/chip8vm/internal/audio"
+	"github.com/kapitanov/chip8vm/internal/hal"
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/vm"
+	"github.com/spf13/pflag"
+)
+
+const (
+	terminalFrontend = "terminal"
+	nullFrontend     = "none"
+)
+
+// frontend provides all devices of a HAL, owning a window, a terminal or the like.
+type frontend interface {
+	vm.Display
+	vm.Audio
+	vm.Input
+	vm.Clock
+	Shutdown()
+}
+
+// frontends maps names of frontends to their constructors,
+// frontends requiring cgo are registered only when it's available.
+var frontends = map[string]func(options hal.Options) (frontend, error){
+	terminalFrontend: func(options hal.Options) (frontend, error) {
+		return hal.NewTerminal(options)
+	},
+	nullFrontend: func(options hal.Options) (frontend, error) {
+		return hal.NewNull(options)
+	},
+}
+
+// defaultFrontend is the frontend used unless --frontend is specified.
+var defaultFrontend = terminalFrontend
+
+// frontendFlags are the command line flags shared by all commands that open a frontend.
+type frontendFlags struct {
+	name       *string
+	keyTimeout *time.Duration
+	keymap     *string
+	frameSync  *bool
+	phosphor   *float64
+	scaleMode  *string
+	fullscreen *bool
+	waveform   *string
+	tone       *float64
+	volume     *float64
+}
+
+func newFrontendFlags(flags *pflag.FlagSet) *frontendFlags {
+	var names []string
+	for name := range frontends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &frontendFlags{
+		name:       flags.String("frontend", defaultFrontend, fmt.Sprintf("frontend (%s)", strings.Join(names, ", "))),
+		keyTimeout: flags.Duration("key-timeout", hal.DefaultKeyReleaseTimeout, "time after which a key is released unless the terminal repeats it, terminal frontend only"),
+		keymap:     flags.String("keymap", "", fmt.Sprintf("keymap preset (%s) or config file, defaults to %s if it exists", strings.Join(keymap.PresetNames(), ", "), configFilePath("keymap.json"))),
+		frameSync:  flags.Bool("frame-sync", false, "present the screen once per frame instead of after every draw, hides sprites erased and redrawn within a frame"),
+		phosphor:   flags.Float64("phosphor", 0, "phosphor decay from 0 to 1 fading pixels out over several frames to reduce flicker, 0 to disable"),
+		scaleMode:  flags.String("scale-mode", hal.ScaleInteger.String(), fmt.Sprintf("scaling of the screen to the window (%s, %s), SDL frontend only", hal.ScaleInteger, hal.ScaleFit)),
+		fullscreen: flags.Bool("fullscreen", false, "start in fullscreen mode, F11 toggles it, SDL frontend only"),
+		waveform:   flags.String("waveform", audio.WaveformSquare.String(), fmt.Sprintf("waveform of the buzzer (%s, %s, %s)", audio.WaveformSquare, audio.WaveformSine, audio.WaveformTriangle)),
+		tone:       flags.Float64("tone", audio.DefaultFrequency, "frequency of the buzzer in Hz"),
+		volume:     flags.Float64("volume", audio.DefaultVolume, "volume of the buzzer, from 0 to 1"),
+	}
+}
+
+// soundConfig returns the sound of the buzzer set by the flags.
+func (f *frontendFlags) soundConfig() (audio.Config, error) {
+	waveform, err := audio.ParseWaveform(*f.waveform)
+	if err != nil {
+		return audio.Config{}, err
+	}
+
+	if *f.tone <= 0 {
+		return audio.Config{}, fmt.Errorf("invalid tone frequency %v", *f.tone)
+	}
+
+	if *f.volume < 0 || *f.volume > 1 {
+		return audio.Config{}, fmt.Errorf("invalid volume %v, expected a value from 0 to 1", *f.volume)
+	}
+
+	return audio.Config{
+		Waveform:  waveform,
+		Frequency: *f.tone,
+		Volume:    *f.volume,
+	}, nil
+}
+
+// romKeymap returns the keymap of a ROM set by the flags.
+func (f *frontendFlags) romKeymap(rom *romFile) (keymap.Keymap, error) {
+	config := &keymap.Config{}
+	switch {
+	case keymap.IsPreset(*f.keymap):
+		config.Preset = *f.keymap
+
+	case *f.keymap != "":
+		var err error
+		if config, err = keymap.Load(*f.keymap); err != nil {
+			return keymap.Keymap{}, err
+		}
+
+	case configFilePath("keymap.json") != "":
+		c, err := keymap.Load(configFilePath("keymap.json"))
+		if err == nil {
+			config = c
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return keymap.Keymap{}, err
+		}
+	}
+
+	return config.Keymap(filepath.Base(rom.path), rom.hash, rom.settings.Keymap)
+}
+
+// newFrontend opens a frontend to run a ROM on.
+func (f *frontendFlags) newFrontend(rom *romFile, options hal.Options) (frontend, error) {
+	newFrontend, ok := frontends[*f.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown frontend %q", *f.name)
+	}
+
+	km, err := f.romKeymap(rom)
+	if err != nil {
+		return nil, err
+	}
+
+	sound, err := f.soundConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scaleMode, err := hal.ParseScaleMode(*f.scaleMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if *f.phosphor < 0 || *f.phosphor >= 1 {
+		return nil, fmt.Errorf("invalid phosphor decay %v, expected a value from 0 to 1", *f.phosphor)
+	}
+
+	options.KeyReleaseTimeout = *f.keyTimeout
+	options.FrameSync = *f.frameSync
+	options.Phosphor = *f.phosphor
+	options.ScaleMode = scaleMode
+	options.Fullscreen = *f.fullscreen
+	options.Sound = sound
+	options.Keymap = km
+	h, err := newFrontend(options)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize %s frontend: %w", *f.name, err)
+	}
+
+	return h, nil
+}
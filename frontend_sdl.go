@@ -0,0 +1,19 @@
+//go:build cgo
+
+package main
+
+import "github.com/kapitanov/chip8vm/internal/hal"
+
+const sdlFrontend = "sdl"
+
+func init() {
+	frontends[sdlFrontend] = func(options hal.Options) (frontend, error) {
+		h, err := hal.New(options)
+		if err != nil {
+			return nil, err
+		}
+
+		return h, nil
+	}
+	defaultFrontend = sdlFrontend
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/vm"
+	"github.com/spf13/cobra"
+)
+
+func newInfoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info PATH_TO_ROM_FILE",
+		Short: "Show what the ROM database knows about a ROM",
+		Long: "Show what the ROM database knows about a ROM.\n" +
+			"The settings are the ones the ROM would be run with, command line flags take precedence " +
+			"over the ones recommended by the database.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	machineFlags := newMachineFlags(cmd.Flags())
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+		rom, err := machineFlags.loadROM(args[0])
+		if err != nil {
+			return err
+		}
+
+		config, err := machineFlags.config(rom)
+		if err != nil {
+			return err
+		}
+
+		return writeInfo(os.Stdout, rom, config)
+	}
+
+	return cmd
+}
+
+func writeInfo(w io.Writer, rom *romFile, config vm.Config) error {
+	var lines [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			lines = append(lines, [2]string{name, value})
+		}
+	}
+
+	add("File", rom.path)
+	add("SHA-1", rom.hash)
+
+	if rom.entry == nil {
+		add("Title", "unknown, not found in the ROM database")
+	} else {
+		program := rom.entry.Program
+		add("Title", program.Title)
+		add("Authors", strings.Join(program.Authors, ", "))
+		add("Release", program.Release)
+		add("Description", program.Description)
+		add("Platforms", strings.Join(rom.entry.ROM.Platforms, ", "))
+	}
+
+	add("Platform", config.Platform.String())
+	add("Quirks", quirksName(config.Quirks))
+	add("Cycles", fmt.Sprintf("%d per frame", config.CyclesPerFrame))
+
+	var colors []string
+	for _, c := range rom.palette {
+		colors = append(colors, fmt.Sprintf("#%06x", c))
+	}
+	add("Palette", strings.Join(colors, " "))
+
+	add("Keys", formatBindings(rom.settings.Keymap.Keys))
+	add("Buttons", formatBindings(rom.settings.Keymap.Buttons))
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%-12s %s\n", line[0]+":", line[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quirksName returns the name of the quirks preset, or lists the quirks
+// if there's no such preset.
+func quirksName(quirks vm.Quirks) string {
+	for _, name := range vm.QuirksPresetNames() {
+		if preset, _ := vm.QuirksPreset(name); preset == quirks {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("%+v", quirks)
+}
+
+func formatBindings(m map[string]keymap.Target) string {
+	var bindings []string
+	for name, target := range m {
+		bindings = append(bindings, fmt.Sprintf("%s=%s", name, target))
+	}
+	sort.Strings(bindings)
+
+	return strings.Join(bindings, " ")
+}
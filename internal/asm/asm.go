@@ -0,0 +1,421 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Error is an error at a line of a source file.
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type position struct {
+	file string
+	line int
+}
+
+// statement is a parsed source line.
+type statement struct {
+	pos      position
+	label    string
+	mnemonic string // Lower case mnemonic or directive, empty for lines with a label only
+	args     []string
+}
+
+type symbol struct {
+	pos       position
+	value     int
+	expr      string // Expression of a constant, empty for labels
+	resolved  bool
+	resolving bool
+}
+
+type assembler struct {
+	statements []*statement
+	symbols    map[string]*symbol
+	constants  []string // Names of constants in order of definition
+	includes   []string // Files being loaded, used to detect circular includes
+	pc         int
+	errs       []error
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		symbols: make(map[string]*symbol),
+		pc:      int(vm.ProgramStart),
+	}
+}
+
+// Assemble assembles a source file into a program loaded at vm.ProgramStart.
+// All errors found are returned, each one is an *Error.
+func Assemble(path string) ([]byte, error) {
+	a := newAssembler()
+
+	a.load(path, position{})
+	if len(a.errs) > 0 {
+		return nil, errors.Join(a.errs...)
+	}
+
+	a.resolveConstants()
+	if len(a.errs) > 0 {
+		return nil, errors.Join(a.errs...)
+	}
+
+	var program []byte
+	for _, stmt := range a.statements {
+		bs, err := a.encode(stmt)
+		if err != nil {
+			a.errorf(stmt.pos, "%v", err)
+			continue
+		}
+		program = append(program, bs...)
+	}
+
+	if len(a.errs) > 0 {
+		return nil, errors.Join(a.errs...)
+	}
+
+	return program, nil
+}
+
+func (a *assembler) errorf(pos position, format string, args ...any) {
+	a.errs = append(a.errs, &Error{File: pos.file, Line: pos.line, Err: fmt.Errorf(format, args...)})
+}
+
+// load parses a source file, defines its labels and constants
+// and lays out its statements.
+func (a *assembler) load(path string, from position) {
+	for _, p := range a.includes {
+		if p == path {
+			a.errorf(from, "circular include of %q", path)
+			return
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		if from.file == "" {
+			a.errs = append(a.errs, err)
+		} else {
+			a.errorf(from, "%v", err)
+		}
+		return
+	}
+
+	a.includes = append(a.includes, path)
+	defer func() { a.includes = a.includes[:len(a.includes)-1] }()
+
+	for i, line := range strings.Split(string(src), "\n") {
+		pos := position{file: path, line: i + 1}
+
+		stmt, err := a.parseLine(pos, line)
+		if err != nil {
+			a.errorf(pos, "%v", err)
+			continue
+		}
+		if stmt == nil {
+			continue
+		}
+
+		switch {
+		case stmt.mnemonic == "equ":
+			a.define(pos, stmt.label, &symbol{pos: pos, expr: stmt.args[0]})
+		case stmt.label != "":
+			a.define(pos, stmt.label, &symbol{pos: pos, value: a.pc, resolved: true})
+		}
+
+		switch stmt.mnemonic {
+		case "":
+			continue
+
+		case "equ":
+			a.constants = append(a.constants, stmt.label)
+			continue
+
+		case "include":
+			a.load(filepath.Join(filepath.Dir(path), stmt.args[0]), pos)
+			continue
+		}
+
+		a.statements = append(a.statements, stmt)
+
+		a.pc += size(stmt)
+		if a.pc > vm.XOChipMemorySize {
+			a.errorf(pos, "program doesn't fit into memory")
+			return
+		}
+	}
+}
+
+func (a *assembler) define(pos position, name string, sym *symbol) {
+	if prev, ok := a.symbols[name]; ok {
+		a.errorf(pos, "%q is already defined at %s:%d", name, prev.pos.file, prev.pos.line)
+		return
+	}
+
+	a.symbols[name] = sym
+}
+
+// size returns the number of bytes a statement occupies.
+func size(stmt *statement) int {
+	switch stmt.mnemonic {
+	case "db":
+		return len(stmt.args)
+	case "dw":
+		return 2 * len(stmt.args)
+	case mvil:
+		return 2 * vm.InstructionSize
+	}
+
+	return vm.InstructionSize
+}
+
+// parseLine parses a line of source. Lines are written as
+//
+//	[label:] [mnemonic [operand, ...]] [; comment]
+//	name equ value
+//	include "path"
+//
+// Returns nil for blank lines.
+func (a *assembler) parseLine(pos position, line string) (*statement, error) {
+	line = strings.TrimSpace(stripComment(line))
+	if line == "" {
+		return nil, nil
+	}
+
+	stmt := &statement{pos: pos}
+
+	head, rest := splitField(line)
+	if strings.HasSuffix(head, ":") {
+		stmt.label = strings.TrimSuffix(head, ":")
+		if err := checkName(stmt.label); err != nil {
+			return nil, err
+		}
+
+		head, rest = splitField(rest)
+		if head == "" {
+			return stmt, nil
+		}
+	}
+
+	if op, value := splitField(rest); strings.EqualFold(op, "equ") {
+		if stmt.label != "" {
+			return nil, fmt.Errorf("unexpected label before constant %q", head)
+		}
+		if err := checkName(head); err != nil {
+			return nil, err
+		}
+		if value == "" {
+			return nil, fmt.Errorf("missing value of constant %q", head)
+		}
+
+		stmt.label = head
+		stmt.mnemonic = "equ"
+		stmt.args = []string{value}
+		return stmt, nil
+	}
+
+	stmt.mnemonic = strings.ToLower(head)
+	switch stmt.mnemonic {
+	case "include":
+		path, err := strconv.Unquote(rest)
+		if err != nil || path == "" {
+			return nil, fmt.Errorf("include expects a quoted file name")
+		}
+		stmt.args = []string{path}
+		return stmt, nil
+
+	case "db", "dw":
+		// Data directives take any number of values
+
+	default:
+		if _, ok := instructions[stmt.mnemonic]; !ok && stmt.mnemonic != mvil {
+			return nil, fmt.Errorf("unknown instruction %q", head)
+		}
+	}
+
+	if rest != "" {
+		for _, arg := range strings.Split(rest, ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				return nil, fmt.Errorf("missing operand")
+			}
+			stmt.args = append(stmt.args, arg)
+		}
+	}
+
+	if (stmt.mnemonic == "db" || stmt.mnemonic == "dw") && len(stmt.args) == 0 {
+		return nil, fmt.Errorf("%s expects at least one value", stmt.mnemonic)
+	}
+
+	return stmt, nil
+}
+
+// stripComment removes a comment, ";" inside quotes doesn't start one.
+func stripComment(line string) string {
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// splitField splits s into the first whitespace separated field and the rest.
+func splitField(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+
+	return s, ""
+}
+
+func checkName(name string) error {
+	if !isName(name) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+
+	if _, ok := parseRegister(name); ok {
+		return fmt.Errorf("%q is a register name", name)
+	}
+
+	return nil
+}
+
+// resolveConstants evaluates all constants, so that their errors are
+// reported once, at the lines they are defined at.
+func (a *assembler) resolveConstants() {
+	for _, name := range a.constants {
+		if _, err := a.lookup(name); err != nil {
+			a.errorf(a.symbols[name].pos, "%v", err)
+		}
+	}
+}
+
+func (a *assembler) lookup(name string) (int, error) {
+	sym, ok := a.symbols[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined symbol %q", name)
+	}
+
+	if sym.resolved {
+		return sym.value, nil
+	}
+
+	if sym.resolving {
+		return 0, fmt.Errorf("circular definition of %q", name)
+	}
+
+	sym.resolving = true
+	defer func() { sym.resolving = false }()
+
+	value, err := a.eval(sym.expr)
+	if err != nil {
+		return 0, err
+	}
+
+	sym.value = value
+	sym.resolved = true
+	return value, nil
+}
+
+// encode returns the bytes of an instruction or a data directive.
+func (a *assembler) encode(stmt *statement) ([]byte, error) {
+	switch stmt.mnemonic {
+	case "db":
+		var bs []byte
+		for _, arg := range stmt.args {
+			v, err := a.evalRange(arg, -0x80, 0xFF)
+			if err != nil {
+				return nil, err
+			}
+			bs = append(bs, uint8(v))
+		}
+		return bs, nil
+
+	case "dw":
+		var bs []byte
+		for _, arg := range stmt.args {
+			v, err := a.evalRange(arg, -0x8000, 0xFFFF)
+			if err != nil {
+				return nil, err
+			}
+			bs = append(bs, uint8(v>>8), uint8(v))
+		}
+		return bs, nil
+
+	case mvil:
+		if len(stmt.args) != 1 {
+			return nil, fmt.Errorf("invalid operands, expected %s NNNN", mvil)
+		}
+
+		v, err := a.evalRange(stmt.args[0], 0, 0xFFFF)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{0xF0, 0x00, uint8(v >> 8), uint8(v)}, nil
+	}
+
+	forms := instructions[stmt.mnemonic]
+	f, ok := match(forms, stmt.args)
+	if !ok {
+		return nil, fmt.Errorf("invalid operands, expected %s", syntax(stmt.mnemonic, forms))
+	}
+
+	values := make([]int, len(stmt.args))
+	for i, arg := range stmt.args {
+		if r, ok := parseRegister(arg); ok {
+			values[i] = r
+			continue
+		}
+
+		v, err := a.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	opcode, err := f.encode(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte{uint8(opcode >> 8), uint8(opcode)}, nil
+}
+
+func (a *assembler) evalRange(expr string, min, max int) (int, error) {
+	v, err := a.eval(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	if v < min || v > max {
+		return 0, fmt.Errorf("value %d is out of range [%d, %d]", v, min, max)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,89 @@
+package asm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/asm"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []byte
+		err  string // Errors with the directory of the source file trimmed
+	}{
+		{
+			name: "instructions, labels and constants",
+			src:  "N equ 2\nstart:\n    mov v0, N + 1\n    mvi data\n    jmp start\ndata:\n    db 0x60, 0xf0\n    dw 0x1234\n",
+			want: []byte{0x60, 0x03, 0xA2, 0x06, 0x12, 0x00, 0x60, 0xF0, 0x12, 0x34},
+		},
+		{
+			name: "unknown mnemonic",
+			src:  "    cls\n    movv v0, 1\n",
+			err:  `rom.s:2: unknown instruction "movv"`,
+		},
+		{
+			name: "byte out of range",
+			src:  "    mov v0, 256\n",
+			err:  "rom.s:1: value 256 is out of range [-128, 255]",
+		},
+		{
+			name: "address out of range",
+			src:  "    jmp 0x1000\n",
+			err:  "rom.s:1: value 4096 is out of range [0, 4095]",
+		},
+		{
+			name: "data out of range",
+			src:  "    db -129\n",
+			err:  "rom.s:1: value -129 is out of range [-128, 255]",
+		},
+		{
+			name: "undefined label",
+			src:  "    jmp loop\n",
+			err:  `rom.s:1: undefined symbol "loop"`,
+		},
+		{
+			name: "every error is reported",
+			src:  "    movv v0, 1\n    jmpp 0x200\n",
+			err:  "rom.s:1: unknown instruction \"movv\"\nrom.s:2: unknown instruction \"jmpp\"",
+		},
+		{
+			name: "duplicate label",
+			src:  "start:\nstart:\n",
+			err:  `rom.s:2: "start" is already defined at rom.s:1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "rom.s")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := asm.Assemble(path)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("Assemble() = % x, want error %q", got, tt.err)
+				}
+				if msg := strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""); msg != tt.err {
+					t.Errorf("Assemble() error = %q, want %q", msg, tt.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Assemble() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
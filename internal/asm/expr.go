@@ -0,0 +1,152 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// eval evaluates an expression. Expressions are made of numbers (decimal,
+// 0x hexadecimal or 0b binary), labels and constants combined with "+", "-"
+// and parentheses.
+func (a *assembler) eval(expr string) (int, error) {
+	p := &exprParser{a: a, s: expr}
+
+	v, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", p.s[p.pos:], expr)
+	}
+
+	return v, nil
+}
+
+type exprParser struct {
+	a   *assembler
+	s   string
+	pos int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// sum parses term {("+" | "-") term}.
+func (p *exprParser) sum() (int, error) {
+	v, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) || (p.s[p.pos] != '+' && p.s[p.pos] != '-') {
+			return v, nil
+		}
+
+		op := p.s[p.pos]
+		p.pos++
+
+		w, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+
+		if op == '+' {
+			v += w
+		} else {
+			v -= w
+		}
+	}
+}
+
+// term parses "-" term | "(" sum ")" | number | name.
+func (p *exprParser) term() (int, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.s) {
+		return 0, fmt.Errorf("unexpected end of expression %q", p.s)
+	}
+
+	switch c := p.s[p.pos]; {
+	case c == '-':
+		p.pos++
+		v, err := p.term()
+		return -v, err
+
+	case c == '(':
+		p.pos++
+		v, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+
+		p.skipSpaces()
+		if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+			return 0, fmt.Errorf("missing \")\" in expression %q", p.s)
+		}
+		p.pos++
+		return v, nil
+
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && isNameChar(p.s[p.pos]) {
+			p.pos++
+		}
+		return parseNumber(p.s[start:p.pos])
+
+	case isNameStart(c):
+		start := p.pos
+		for p.pos < len(p.s) && isNameChar(p.s[p.pos]) {
+			p.pos++
+		}
+		return p.a.lookup(p.s[start:p.pos])
+	}
+
+	return 0, fmt.Errorf("unexpected %q in expression %q", p.s[p.pos:], p.s)
+}
+
+func parseNumber(s string) (int, error) {
+	base := 10
+	digits := s
+	switch lower := strings.ToLower(s); {
+	case strings.HasPrefix(lower, "0x"):
+		base, digits = 16, s[2:]
+	case strings.HasPrefix(lower, "0b"):
+		base, digits = 2, s[2:]
+	}
+
+	v, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+
+	return int(v), nil
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
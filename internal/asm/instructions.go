@@ -0,0 +1,209 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type operandKind int
+
+const (
+	operandRegister operandKind = iota // vX, 4 bits
+	operandNibble                      // N, 4 bits
+	operandByte                        // NN, 8 bits
+	operandAddr                        // NNN, 12 bits
+)
+
+// operand describes an operand of an instruction and its position in the opcode.
+type operand struct {
+	kind  operandKind
+	shift uint
+}
+
+// form is one of the operand sets an instruction can be written with.
+type form struct {
+	opcode   uint16
+	operands []operand
+}
+
+var (
+	regX   = operand{operandRegister, 8}
+	regY   = operand{operandRegister, 4}
+	nibX   = operand{operandNibble, 8}
+	nibN   = operand{operandNibble, 0}
+	byteNN = operand{operandByte, 0}
+	addr   = operand{operandAddr, 0}
+)
+
+// mvil is the only instruction that is 4 bytes long, it's handled separately.
+const mvil = "mvil"
+
+// instructions maps mnemonics, as printed by the disassembler, to their forms.
+var instructions = map[string][]form{
+	"cls":     {{0x00E0, nil}},
+	"rts":     {{0x00EE, nil}},
+	"scdown":  {{0x00C0, []operand{nibN}}},
+	"scup":    {{0x00D0, []operand{nibN}}},
+	"scright": {{0x00FB, nil}},
+	"scleft":  {{0x00FC, nil}},
+	"exit":    {{0x00FD, nil}},
+	"low":     {{0x00FE, nil}},
+	"high":    {{0x00FF, nil}},
+	"jmp":     {{0x1000, []operand{addr}}},
+	"jsr":     {{0x2000, []operand{addr}}},
+	"skeq":    {{0x3000, []operand{regX, byteNN}}, {0x5000, []operand{regX, regY}}},
+	"skne":    {{0x4000, []operand{regX, byteNN}}, {0x9000, []operand{regX, regY}}},
+	"save":    {{0x5002, []operand{regX, regY}}},
+	"load":    {{0x5003, []operand{regX, regY}}},
+	"mov":     {{0x6000, []operand{regX, byteNN}}, {0x8000, []operand{regX, regY}}},
+	"add":     {{0x7000, []operand{regX, byteNN}}, {0x8004, []operand{regX, regY}}},
+	"or":      {{0x8001, []operand{regX, regY}}},
+	"and":     {{0x8002, []operand{regX, regY}}},
+	"xor":     {{0x8003, []operand{regX, regY}}},
+	"sub":     {{0x8005, []operand{regX, regY}}},
+	"shr":     {{0x8006, []operand{regX}}, {0x8006, []operand{regX, regY}}},
+	"rsb":     {{0x8007, []operand{regX, regY}}},
+	"shl":     {{0x800E, []operand{regX}}, {0x800E, []operand{regX, regY}}},
+	"mvi":     {{0xA000, []operand{addr}}},
+	"jmi":     {{0xB000, []operand{addr}}},
+	"rand":    {{0xC000, []operand{regX, byteNN}}},
+	"sprite":  {{0xD000, []operand{regX, regY, nibN}}},
+	"xsprite": {{0xD000, []operand{regX, regY}}},
+	"skpr":    {{0xE09E, []operand{regX}}},
+	"skup":    {{0xE0A1, []operand{regX}}},
+	"plane":   {{0xF001, []operand{nibX}}},
+	"audio":   {{0xF002, nil}},
+	"gdelay":  {{0xF007, []operand{regX}}},
+	"key":     {{0xF00A, []operand{regX}}},
+	"sdelay":  {{0xF015, []operand{regX}}},
+	"ssound":  {{0xF018, []operand{regX}}},
+	"adi":     {{0xF01E, []operand{regX}}},
+	"font":    {{0xF029, []operand{regX}}},
+	"xfont":   {{0xF030, []operand{regX}}},
+	"bcd":     {{0xF033, []operand{regX}}},
+	"pitch":   {{0xF03A, []operand{regX}}},
+	"str":     {{0xF055, []operand{nibX}}},
+	"ldr":     {{0xF065, []operand{nibX}}},
+	"strf":    {{0xF075, []operand{nibX}}},
+	"ldrf":    {{0xF085, []operand{nibX}}},
+}
+
+// match returns the form matching the operands, registers must be
+// written as registers and values as values.
+func match(forms []form, args []string) (*form, bool) {
+	for i, f := range forms {
+		if len(f.operands) != len(args) {
+			continue
+		}
+
+		ok := true
+		for j, op := range f.operands {
+			_, isRegister := parseRegister(args[j])
+			if isRegister != (op.kind == operandRegister) {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			return &forms[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// syntax returns a description of the forms of an instruction for error messages.
+func syntax(mnemonic string, forms []form) string {
+	var variants []string
+	for _, f := range forms {
+		var ops []string
+		for _, op := range f.operands {
+			switch {
+			case op.kind == operandRegister && op.shift == 8:
+				ops = append(ops, "vX")
+			case op.kind == operandRegister:
+				ops = append(ops, "vY")
+			case op.kind == operandNibble:
+				ops = append(ops, "N")
+			case op.kind == operandByte:
+				ops = append(ops, "NN")
+			case op.kind == operandAddr:
+				ops = append(ops, "NNN")
+			}
+		}
+
+		variants = append(variants, strings.TrimSpace(mnemonic+" "+strings.Join(ops, ", ")))
+	}
+
+	return strings.Join(variants, " or ")
+}
+
+// encode puts the operand values into the opcode.
+func (f *form) encode(values []int) (uint16, error) {
+	opcode := f.opcode
+	for i, op := range f.operands {
+		v := values[i]
+
+		var bits uint
+		min := 0
+		switch op.kind {
+		case operandRegister, operandNibble:
+			bits = 4
+		case operandByte:
+			bits = 8
+			// Allow negative bytes, e.g. "add v0, -1"
+			min = -128
+		case operandAddr:
+			bits = 12
+		}
+
+		max := 1<<bits - 1
+		if v < min || v > max {
+			return 0, fmt.Errorf("value %d is out of range [%d, %d]", v, min, max)
+		}
+
+		opcode |= uint16(v&max) << op.shift
+	}
+
+	return opcode, nil
+}
+
+// parseRegister parses a register name, v0 to vf.
+func parseRegister(s string) (int, bool) {
+	if len(s) != 2 || (s[0] != 'v' && s[0] != 'V') {
+		return 0, false
+	}
+
+	c := s[1]
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10, true
+	}
+
+	return 0, false
+}
+
+// Encode assembles a single instruction with literal operands,
+// e.g. "skeq v1, 10".
+func Encode(text string) ([]byte, error) {
+	a := newAssembler()
+	stmt, err := a.parseLine(position{}, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt == nil || stmt.label != "" {
+		return nil, fmt.Errorf("%q is not an instruction", text)
+	}
+
+	if _, ok := instructions[stmt.mnemonic]; !ok && stmt.mnemonic != mvil {
+		return nil, fmt.Errorf("%q is not an instruction", text)
+	}
+
+	return a.encode(stmt)
+}
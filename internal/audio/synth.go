@@ -0,0 +1,149 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+const (
+	SampleRate      = 48000
+	SamplesPerFrame = SampleRate / vm.FrameRate
+
+	DefaultFrequency = 440.0
+	DefaultVolume    = 0.25
+)
+
+type Waveform int
+
+const (
+	WaveformSquare Waveform = iota
+	WaveformSine
+	WaveformTriangle
+)
+
+var waveformNames = map[Waveform]string{
+	WaveformSquare:   "square",
+	WaveformSine:     "sine",
+	WaveformTriangle: "triangle",
+}
+
+func (w Waveform) String() string {
+	return waveformNames[w]
+}
+
+func ParseWaveform(name string) (Waveform, error) {
+	for w, n := range waveformNames {
+		if n == name {
+			return w, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown waveform %q", name)
+}
+
+// Config is the sound of the buzzer. XO-CHIP audio patterns are played
+// as they are, only the volume applies to them.
+type Config struct {
+	Waveform  Waveform
+	Frequency float64 // Tone frequency in Hz
+	Volume    float64 // From 0 to 1
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Waveform:  WaveformSquare,
+		Frequency: DefaultFrequency,
+		Volume:    DefaultVolume,
+	}
+}
+
+// Synth generates the buzzer sound frame by frame. The waveform continues
+// seamlessly from one frame to another while the buzzer sounds.
+type Synth struct {
+	config Config
+	phase  float64 // Position within the tone period, from 0 to 1
+	bit    float64 // Position within the audio pattern, in bits
+	on     bool
+	buffer []int16
+}
+
+func NewSynth(config Config) *Synth {
+	if config.Frequency <= 0 {
+		config.Frequency = DefaultFrequency
+	}
+
+	return &Synth{
+		config: config,
+		buffer: make([]int16, SamplesPerFrame),
+	}
+}
+
+// Frame returns the samples of a frame, they are only valid until the next call.
+func (s *Synth) Frame(on bool, pattern *vm.AudioPattern) []int16 {
+	if !on {
+		s.on = false
+		clear(s.buffer)
+		return s.buffer
+	}
+
+	if !s.on {
+		// Start from the beginning of the period to avoid clicks
+		s.on = true
+		s.phase = 0
+		s.bit = 0
+	}
+
+	gain := math.Max(0, math.Min(1, s.config.Volume)) * math.MaxInt16
+
+	if pattern != nil {
+		const bitCount = 8 * vm.AudioPatternSize
+
+		step := pattern.SampleRate() / SampleRate
+		for i := range s.buffer {
+			bit := int(s.bit) % bitCount
+			if pattern.Samples[bit/8]&(0x80>>(bit%8)) != 0 {
+				s.buffer[i] = int16(gain)
+			} else {
+				s.buffer[i] = int16(-gain)
+			}
+			s.bit = math.Mod(s.bit+step, bitCount)
+		}
+
+		return s.buffer
+	}
+
+	step := s.config.Frequency / SampleRate
+	for i := range s.buffer {
+		s.buffer[i] = int16(gain * s.wave(s.phase))
+		s.phase = math.Mod(s.phase+step, 1)
+	}
+
+	return s.buffer
+}
+
+// wave returns the value of the waveform at a position within its period.
+func (s *Synth) wave(phase float64) float64 {
+	switch s.config.Waveform {
+	case WaveformSine:
+		return math.Sin(2 * math.Pi * phase)
+	case WaveformTriangle:
+		return 1 - 4*math.Abs(phase-0.5)
+	default:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	}
+}
+
+// Bytes packs samples as signed 16-bit little-endian values.
+func Bytes(samples []int16, buf []byte) []byte {
+	buf = buf[:0]
+	for _, sample := range samples {
+		buf = append(buf, byte(sample), byte(uint16(sample)>>8))
+	}
+
+	return buf
+}
@@ -0,0 +1,108 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+const wavHeaderSize = 44
+
+// WAV is an Audio writing the buzzer sound to a mono 16-bit WAV file.
+// It wraps the Audio of another HAL, which can be nil.
+type WAV struct {
+	audio vm.Audio
+	w     io.WriteSeeker
+	synth *Synth
+	size  int // Number of bytes of samples written
+	buf   []byte
+	err   error
+}
+
+func NewWAV(w io.WriteSeeker, config Config, audio vm.Audio) (*WAV, error) {
+	wav := &WAV{
+		audio: audio,
+		w:     w,
+		synth: NewSynth(config),
+	}
+
+	// Sizes are unknown until the end, the header is rewritten on close
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return wav, nil
+}
+
+func (wav *WAV) Sound(on bool, pattern *vm.AudioPattern) error {
+	if wav.err == nil {
+		wav.buf = Bytes(wav.synth.Frame(on, pattern), wav.buf)
+		_, wav.err = wav.w.Write(wav.buf)
+		wav.size += len(wav.buf)
+	}
+
+	if wav.audio == nil {
+		return nil
+	}
+
+	return wav.audio.Sound(on, pattern)
+}
+
+// Close completes the file, the underlying writer is not closed.
+func (wav *WAV) Close() error {
+	if wav.err != nil {
+		return wav.err
+	}
+
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := wav.writeHeader(); err != nil {
+		return err
+	}
+
+	_, err := wav.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (wav *WAV) writeHeader() error {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+
+	header := struct {
+		RIFF          [4]byte
+		ChunkSize     uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(wavHeaderSize - 8 + wav.size),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      channels,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * blockAlign,
+		BlockAlign:    blockAlign,
+		BitsPerSample: bitsPerSample,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(wav.size),
+	}
+
+	return binary.Write(wav.w, binary.LittleEndian, &header)
+}
@@ -0,0 +1,162 @@
+package capture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// DefaultScale is the default size of a high resolution pixel in captures,
+// low resolution pixels are twice as big.
+const DefaultScale = 4
+
+// minDelay is the shortest GIF frame delay in 1/100 s most viewers respect,
+// shorter frames are slowed down to 1/10 s.
+const minDelay = 2
+
+// WritePNG writes a screen as a PNG image.
+func WritePNG(w io.Writer, fb vm.Framebuffer, p *palette.Palette, scale int) error {
+	return png.Encode(w, scaleImage(fb, p.ColorPalette(), scale))
+}
+
+// scaleImage renders a screen as a paletted image of the high resolution
+// screen size times scale.
+func scaleImage(fb vm.Framebuffer, colors color.Palette, scale int) *image.Paletted {
+	if scale <= 0 {
+		scale = DefaultScale
+	}
+
+	width := vm.HiResScreenWidth * scale
+	height := vm.HiResScreenHeight * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, height), colors)
+
+	scaleX := width / fb.Width
+	scaleY := height / fb.Height
+	for y := 0; y < height; y++ {
+		row := fb.Pixels[(y/scaleY)*fb.Width:]
+		for x := 0; x < width; x++ {
+			img.Pix[y*img.Stride+x] = row[x/scaleX] % uint8(len(colors))
+		}
+	}
+
+	return img
+}
+
+// GIF records every screen drawn to an animated GIF. It's both a Display
+// and a Clock wrapping the ones of another HAL (any of them can be nil),
+// the clock is used to time the frames.
+type GIF struct {
+	display vm.Display
+	clock   vm.Clock
+	colors  color.Palette
+	scale   int
+
+	frame   int            // Number of frames passed
+	current vm.Framebuffer // Last drawn screen
+	dirty   bool           // Indicates the screen has been drawn in the current frame
+
+	screens []vm.Framebuffer // Recorded screens, scaled up on encoding
+	starts  []int            // Frame each recorded screen appears at
+}
+
+func NewGIF(p *palette.Palette, scale int, display vm.Display, clock vm.Clock) *GIF {
+	return &GIF{
+		display: display,
+		clock:   clock,
+		colors:  p.ColorPalette(),
+		scale:   scale,
+	}
+}
+
+func (g *GIF) Draw(fb vm.Framebuffer) error {
+	g.current.Width = fb.Width
+	g.current.Height = fb.Height
+	g.current.Pixels = append(g.current.Pixels[:0], fb.Pixels...)
+	g.dirty = true
+
+	if g.display == nil {
+		return nil
+	}
+
+	return g.display.Draw(fb)
+}
+
+func (g *GIF) WaitForNextFrame() error {
+	if g.dirty {
+		g.dirty = false
+		g.add()
+	}
+	g.frame++
+
+	if g.clock == nil {
+		return nil
+	}
+
+	return g.clock.WaitForNextFrame()
+}
+
+// add records the current screen. Frames shorter than minDelay are merged
+// into the previous one, so that timing is kept right as close as possible.
+func (g *GIF) add() {
+	fb := g.current
+	fb.Pixels = append([]uint8(nil), fb.Pixels...)
+
+	n := len(g.screens)
+	if n > 0 && sameScreen(g.screens[n-1], fb) {
+		return
+	}
+
+	if n > 0 && centiseconds(g.frame)-centiseconds(g.starts[n-1]) < minDelay {
+		g.screens[n-1] = fb
+		return
+	}
+
+	g.screens = append(g.screens, fb)
+	g.starts = append(g.starts, g.frame)
+}
+
+func sameScreen(a, b vm.Framebuffer) bool {
+	return a.Width == b.Width && a.Height == b.Height && bytes.Equal(a.Pixels, b.Pixels)
+}
+
+// Frames returns the number of frames passed since the recording started.
+func (g *GIF) Frames() int {
+	return g.frame
+}
+
+// Encode writes the recorded frames as a looped GIF animation.
+func (g *GIF) Encode(w io.Writer) error {
+	if len(g.screens) == 0 {
+		// Nothing has been drawn, record a blank screen
+		g.screens = append(g.screens, vm.Framebuffer{
+			Width:  vm.ScreenWidth,
+			Height: vm.ScreenHeight,
+			Pixels: make([]uint8, vm.ScreenWidth*vm.ScreenHeight),
+		})
+		g.starts = append(g.starts, 0)
+	}
+
+	anim := &gif.GIF{}
+	for i, fb := range g.screens {
+		end := g.frame
+		if i+1 < len(g.starts) {
+			end = g.starts[i+1]
+		}
+
+		anim.Image = append(anim.Image, scaleImage(fb, g.colors, g.scale))
+		anim.Delay = append(anim.Delay, max(centiseconds(end)-centiseconds(g.starts[i]), minDelay))
+	}
+
+	return gif.EncodeAll(w, anim)
+}
+
+// centiseconds returns the time at which a frame starts in 1/100 s.
+func centiseconds(frame int) int {
+	return (frame*100 + vm.FrameRate/2) / vm.FrameRate
+}
@@ -0,0 +1,355 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+type command struct {
+	names   []string
+	usage   string
+	help    string
+	execute func(d *Debugger, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{[]string{"help", "h"}, "help", "show this help", (*Debugger).helpCommand},
+		{[]string{"continue", "c"}, "continue", "resume execution", (*Debugger).continueCommand},
+		{[]string{"pause", "p"}, "pause", "pause execution", (*Debugger).pauseCommand},
+		{[]string{"step", "s"}, "step [N]", "execute N instructions (1 by default)", (*Debugger).stepCommand},
+		{[]string{"next", "n"}, "next", "execute an instruction, stepping over subroutine calls", (*Debugger).nextCommand},
+		{[]string{"finish", "f"}, "finish", "execute until the current subroutine returns", (*Debugger).finishCommand},
+		{[]string{"break", "b"}, "break ADDR [if REG OP VALUE]", "set a breakpoint, optionally conditional (e.g. if v3 == 0x10)", (*Debugger).breakCommand},
+		{[]string{"watch", "w"}, "watch ADDR[-END] [r|w|rw]", "set a watchpoint on reads and/or writes of a memory range", (*Debugger).watchCommand},
+		{[]string{"delete", "d"}, "delete ID", "delete a breakpoint or a watchpoint", (*Debugger).deleteCommand},
+		{[]string{"list", "l"}, "list", "list breakpoints and watchpoints", (*Debugger).listCommand},
+		{[]string{"regs", "r"}, "regs", "show registers, timers and stack", (*Debugger).regsCommand},
+		{[]string{"mem", "x"}, "mem ADDR [N]", "show N bytes of memory (64 by default)", (*Debugger).memCommand},
+		{[]string{"dis", "u"}, "dis [ADDR] [N]", "disassemble N instructions (10 by default) starting at ADDR (pc by default)", (*Debugger).disCommand},
+		{[]string{"quit", "q"}, "quit", "exit the debugger", (*Debugger).quitCommand},
+	}
+}
+
+func (d *Debugger) execute(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+
+	for _, cmd := range commands {
+		for _, name := range cmd.names {
+			if name == args[0] {
+				if err := cmd.execute(d, args[1:]); err != nil {
+					d.printf("error: %v\n", err)
+				}
+				return
+			}
+		}
+	}
+
+	d.printf("error: unknown command %q, type \"help\" for the list of commands\n", args[0])
+}
+
+func (d *Debugger) helpCommand(_ []string) error {
+	for _, cmd := range commands {
+		d.printf("  %-32s %s\n", cmd.usage, cmd.help)
+	}
+	d.printf("Numbers are decimal unless prefixed with 0x.\n")
+	return nil
+}
+
+func (d *Debugger) continueCommand(_ []string) error {
+	if !d.paused {
+		return fmt.Errorf("already running")
+	}
+
+	d.resume(nil)
+	return nil
+}
+
+func (d *Debugger) pauseCommand(_ []string) error {
+	if d.paused {
+		return fmt.Errorf("already paused")
+	}
+
+	d.pause("paused")
+	return nil
+}
+
+func (d *Debugger) stepCommand(args []string) error {
+	n := 1
+	if len(args) > 0 {
+		v, err := strconv.ParseUint(args[0], 0, 31)
+		if err != nil || v == 0 {
+			return fmt.Errorf("invalid instruction count %q", args[0])
+		}
+		n = int(v)
+	}
+
+	d.resume(func() bool {
+		n--
+		return n <= 0
+	})
+	return nil
+}
+
+func (d *Debugger) nextCommand(_ []string) error {
+	pc := d.state.PC
+	if d.opcode(pc)&0xF000 != 0x2000 {
+		return d.stepCommand(nil)
+	}
+
+	// Run until the subroutine returns to the next instruction
+	sp := d.state.SP
+	d.resume(func() bool {
+		return d.state.PC == pc+vm.InstructionSize && d.state.SP == sp
+	})
+	return nil
+}
+
+func (d *Debugger) finishCommand(_ []string) error {
+	sp := d.state.SP
+	if sp == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+
+	d.resume(func() bool {
+		return d.state.SP < sp
+	})
+	return nil
+}
+
+func (d *Debugger) breakCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: break ADDR [if REG OP VALUE]")
+	}
+
+	addr, err := parseAddr(args[0])
+	if err != nil {
+		return err
+	}
+
+	bp := &breakpoint{addr: addr}
+	if len(args) > 1 {
+		if args[1] != "if" {
+			return fmt.Errorf("expected \"if\", got %q", args[1])
+		}
+
+		bp.condition, err = parseCondition(args[2:])
+		if err != nil {
+			return err
+		}
+	}
+
+	bp.id = d.newID()
+	d.breakpoints = append(d.breakpoints, bp)
+	d.printf("breakpoint %d at 0x%04x%s\n", bp.id, bp.addr, bp.condition)
+	return nil
+}
+
+func (d *Debugger) watchCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: watch ADDR[-END] [r|w|rw]")
+	}
+
+	startArg, endArg, isRange := strings.Cut(args[0], "-")
+	start, err := parseAddr(startArg)
+	if err != nil {
+		return err
+	}
+
+	end := start
+	if isRange {
+		end, err = parseAddr(endArg)
+		if err != nil {
+			return err
+		}
+
+		if end < start {
+			return fmt.Errorf("invalid range %s", args[0])
+		}
+	}
+
+	wp := &watchpoint{start: start, end: end, read: true, write: true}
+	if len(args) > 1 {
+		switch args[1] {
+		case "r":
+			wp.write = false
+		case "w":
+			wp.read = false
+		case "rw":
+		default:
+			return fmt.Errorf("invalid access %q, expected r, w or rw", args[1])
+		}
+	}
+
+	wp.id = d.newID()
+	d.watchpoints = append(d.watchpoints, wp)
+	d.printf("watchpoint %d at %s\n", wp.id, wp)
+	return nil
+}
+
+func (d *Debugger) deleteCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: delete ID")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid id %q", args[0])
+	}
+
+	for i, bp := range d.breakpoints {
+		if bp.id == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+
+	for i, wp := range d.watchpoints {
+		if wp.id == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+func (d *Debugger) listCommand(_ []string) error {
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		d.printf("no breakpoints or watchpoints\n")
+		return nil
+	}
+
+	for _, bp := range d.breakpoints {
+		d.printf("%3d  break 0x%04x%s\n", bp.id, bp.addr, bp.condition)
+	}
+
+	for _, wp := range d.watchpoints {
+		d.printf("%3d  watch %s\n", wp.id, wp)
+	}
+
+	return nil
+}
+
+func (d *Debugger) regsCommand(_ []string) error {
+	s := &d.state
+	d.printf("pc=0x%04x  i=0x%04x  sp=%d  dt=%d  st=%d\n", s.PC, s.Index, s.SP, s.DelayTimer, s.SoundTimer)
+
+	for i, v := range s.Registers {
+		d.printf("v%x=0x%02x", i, v)
+		if i%8 == 7 {
+			d.printf("\n")
+		} else {
+			d.printf("  ")
+		}
+	}
+
+	d.printf("stack:")
+	for _, addr := range s.Stack {
+		d.printf(" 0x%04x", addr)
+	}
+	d.printf("\n")
+	return nil
+}
+
+func (d *Debugger) memCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: mem ADDR [N]")
+	}
+
+	addr, err := parseAddr(args[0])
+	if err != nil {
+		return err
+	}
+
+	n := 64
+	if len(args) > 1 {
+		v, err := strconv.ParseUint(args[1], 0, 16)
+		if err != nil {
+			return fmt.Errorf("invalid byte count %q", args[1])
+		}
+		n = int(v)
+	}
+
+	memory := d.state.Memory
+	for i := 0; i < n && int(addr)+i < len(memory); i++ {
+		if i%16 == 0 {
+			if i > 0 {
+				d.printf("\n")
+			}
+			d.printf("0x%04x:", int(addr)+i)
+		}
+		d.printf(" %02x", memory[int(addr)+i])
+	}
+	d.printf("\n")
+	return nil
+}
+
+func (d *Debugger) disCommand(args []string) error {
+	addr := d.state.PC
+	if len(args) > 0 {
+		var err error
+		addr, err = parseAddr(args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	n := 10
+	if len(args) > 1 {
+		v, err := strconv.ParseUint(args[1], 0, 16)
+		if err != nil {
+			return fmt.Errorf("invalid instruction count %q", args[1])
+		}
+		n = int(v)
+	}
+
+	for i := 0; i < n; i++ {
+		d.printf("%s\n", d.disassemble(addr))
+		addr += vm.InstructionSize
+	}
+	return nil
+}
+
+func (d *Debugger) quitCommand(_ []string) error {
+	d.quit = true
+	return nil
+}
+
+func (d *Debugger) newID() int {
+	id := d.nextID
+	d.nextID++
+	return id
+}
+
+func (wp *watchpoint) String() string {
+	access := "rw"
+	if !wp.read {
+		access = "w"
+	} else if !wp.write {
+		access = "r"
+	}
+
+	if wp.start == wp.end {
+		return fmt.Sprintf("0x%04x %s", wp.start, access)
+	}
+
+	return fmt.Sprintf("0x%04x-0x%04x %s", wp.start, wp.end, access)
+}
+
+func parseAddr(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	return uint16(v), nil
+}
@@ -0,0 +1,92 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// condition compares a register to a constant, e.g. "v3 == 0x10" or "i >= 0x300".
+type condition struct {
+	register string
+	op       string
+	value    uint16
+}
+
+var conditionOps = map[string]func(a, b uint16) bool{
+	"==": func(a, b uint16) bool { return a == b },
+	"!=": func(a, b uint16) bool { return a != b },
+	"<":  func(a, b uint16) bool { return a < b },
+	"<=": func(a, b uint16) bool { return a <= b },
+	">":  func(a, b uint16) bool { return a > b },
+	">=": func(a, b uint16) bool { return a >= b },
+}
+
+func parseCondition(args []string) (*condition, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("expected condition like \"v3 == 0x10\"")
+	}
+
+	c := &condition{
+		register: strings.ToLower(args[0]),
+		op:       args[1],
+	}
+
+	if !isRegister(c.register) {
+		return nil, fmt.Errorf("invalid register %q, expected v0-vf, i, dt or st", args[0])
+	}
+
+	if _, ok := conditionOps[c.op]; !ok {
+		return nil, fmt.Errorf("invalid operator %q, expected one of ==, !=, <, <=, >, >=", c.op)
+	}
+
+	v, err := strconv.ParseUint(args[2], 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", args[2])
+	}
+	c.value = uint16(v)
+
+	return c, nil
+}
+
+func (c *condition) eval(state *vm.Snapshot) bool {
+	return conditionOps[c.op](registerValue(state, c.register), c.value)
+}
+
+func isRegister(name string) bool {
+	switch name {
+	case "i", "dt", "st":
+		return true
+	}
+
+	if len(name) == 2 && name[0] == 'v' {
+		_, err := strconv.ParseUint(name[1:], 16, 8)
+		return err == nil
+	}
+
+	return false
+}
+
+func registerValue(state *vm.Snapshot, name string) uint16 {
+	switch name {
+	case "i":
+		return state.Index
+	case "dt":
+		return uint16(state.DelayTimer)
+	case "st":
+		return uint16(state.SoundTimer)
+	}
+
+	n, _ := strconv.ParseUint(name[1:], 16, 8)
+	return uint16(state.Registers[n])
+}
+
+func (c *condition) String() string {
+	if c == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(" if %s %s 0x%x", c.register, c.op, c.value)
+}
@@ -0,0 +1,266 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Debugger runs a VM under control of commands read line by line from
+// its input and writes their results to its output.
+type Debugger struct {
+	machine *vm.VM
+	state   vm.Snapshot // State of the VM after the last instruction, commands only read this copy
+	out     io.Writer
+	lines   chan string // Command lines, closed when the input is exhausted
+
+	breakpoints []*breakpoint
+	watchpoints []*watchpoint
+	nextID      int
+
+	paused         bool
+	quit           bool
+	skipBreakpoint bool        // Indicates a breakpoint at the current pc must not pause the VM
+	until          func() bool // Pauses the VM once it returns true, set by stepping commands
+	watchHit       string      // Description of the watchpoint hit by the last instruction
+}
+
+type breakpoint struct {
+	id        int
+	addr      uint16
+	condition *condition
+}
+
+type watchpoint struct {
+	id    int
+	start uint16
+	end   uint16
+	read  bool
+	write bool
+}
+
+// New creates a debugger for the VM. The VM is expected to be reset.
+func New(machine *vm.VM, in io.Reader, out io.Writer) *Debugger {
+	d := &Debugger{
+		machine: machine,
+		out:     out,
+		lines:   make(chan string),
+		nextID:  1,
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			d.lines <- scanner.Text()
+		}
+		close(d.lines)
+	}()
+
+	return d
+}
+
+// Run executes the VM starting in paused state until the quit command is
+// entered or the input is exhausted. HAL errors are returned as is.
+func (d *Debugger) Run(hal vm.HAL) error {
+	d.machine.SetMemoryWatch(d.checkWatchpoints)
+	defer d.machine.SetMemoryWatch(nil)
+
+	d.state = d.machine.Snapshot()
+	d.pause("")
+
+	for !d.quit {
+		var err error
+		if d.paused {
+			err = d.idle(hal)
+		} else {
+			err = d.run(hal)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// idle executes pending commands and keeps the HAL responsive while the VM is paused.
+func (d *Debugger) idle(hal vm.HAL) error {
+	for d.paused && !d.quit {
+		select {
+		case line, ok := <-d.lines:
+			if !ok {
+				d.quit = true
+				return nil
+			}
+
+			d.execute(line)
+			if d.paused && !d.quit {
+				d.prompt()
+			}
+			continue
+
+		default:
+		}
+
+		if err := hal.ReadInput(func(vm.Key) {}, func(vm.Key) {}); err != nil {
+			return err
+		}
+
+		if err := hal.WaitForNextFrame(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run executes instructions until the VM gets paused.
+func (d *Debugger) run(hal vm.HAL) error {
+	for !d.paused && !d.quit {
+		select {
+		case line, ok := <-d.lines:
+			if !ok {
+				d.quit = true
+				return nil
+			}
+
+			d.execute(line)
+			continue
+
+		default:
+		}
+
+		if !d.skipBreakpoint {
+			if bp := d.breakpointAt(d.state.PC); bp != nil {
+				d.pause(fmt.Sprintf("breakpoint %d at 0x%04x", bp.id, bp.addr))
+				return nil
+			}
+		}
+		d.skipBreakpoint = false
+
+		d.watchHit = ""
+		err := d.machine.Step(hal)
+		d.state = d.machine.Snapshot()
+
+		var fault *vm.Fault
+		switch {
+		case errors.Is(err, vm.ErrInfiniteLoop) || errors.Is(err, vm.ErrExit):
+			d.pause(fmt.Sprintf("program halted: %v", err))
+			return nil
+
+		case errors.As(err, &fault):
+			// Keep the faulting instruction current, so that it can be inspected
+			d.pause(fmt.Sprintf("program faulted: %s at 0x%04x (opcode 0x%04x)", fault.Kind, fault.PC, fault.Opcode))
+			return nil
+
+		case err != nil:
+			return err
+		}
+
+		if d.watchHit != "" {
+			d.pause(d.watchHit)
+			return nil
+		}
+
+		if d.until != nil && d.until() {
+			d.pause("")
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (d *Debugger) resume(until func() bool) {
+	d.paused = false
+	d.skipBreakpoint = true
+	d.until = until
+}
+
+func (d *Debugger) pause(reason string) {
+	d.paused = true
+	d.until = nil
+
+	if reason != "" {
+		d.printf("%s\n", reason)
+	}
+	d.printf("%s\n", d.disassemble(d.state.PC))
+	d.prompt()
+}
+
+func (d *Debugger) prompt() {
+	d.printf("(chip8) ")
+}
+
+func (d *Debugger) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(d.out, format, args...)
+}
+
+func (d *Debugger) breakpointAt(addr uint16) *breakpoint {
+	for _, bp := range d.breakpoints {
+		if bp.addr != addr {
+			continue
+		}
+
+		if bp.condition == nil || bp.condition.eval(&d.state) {
+			return bp
+		}
+	}
+
+	return nil
+}
+
+// checkWatchpoints is called by the VM while it executes the instruction
+// at d.state.PC.
+func (d *Debugger) checkWatchpoints(addr uint16, size int, write bool) {
+	end := int(addr) + size - 1
+
+	for _, wp := range d.watchpoints {
+		if int(wp.start) > end || int(wp.end) < int(addr) {
+			continue
+		}
+
+		if (write && wp.write) || (!write && wp.read) {
+			access := "read"
+			if write {
+				access = "write"
+			}
+
+			d.watchHit = fmt.Sprintf("watchpoint %d: %s of %d bytes at 0x%04x by instruction at 0x%04x",
+				wp.id, access, size, addr, d.state.PC)
+			return
+		}
+	}
+}
+
+func (d *Debugger) disassemble(addr uint16) string {
+	marker := " "
+	if addr == d.state.PC {
+		marker = ">"
+	}
+
+	bp := " "
+	for _, b := range d.breakpoints {
+		if b.addr == addr {
+			bp = "*"
+		}
+	}
+
+	opcode := d.opcode(addr)
+	return strings.TrimRight(fmt.Sprintf("%s%s 0x%04x: %04x  %s", marker, bp, addr, opcode, vm.Disassemble(opcode)), " ")
+}
+
+// opcode returns the opcode at an address, 0 past the end of memory.
+func (d *Debugger) opcode(addr uint16) uint16 {
+	memory := d.state.Memory
+	if int(addr)+1 >= len(memory) {
+		return 0
+	}
+
+	return uint16(memory[addr])<<8 | uint16(memory[addr+1])
+}
@@ -0,0 +1,296 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/internal/asm"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// maxDataLineSize is the maximum number of bytes in a single data line
+const maxDataLineSize = 8
+
+// Line is a single line of a disassembly listing: either an instruction
+// or a run of data bytes, optionally preceded by a label.
+type Line struct {
+	Addr   uint16
+	Bytes  []byte
+	Label  string
+	Text   string
+	IsCode bool
+}
+
+// disassembler traverses the program from its entry point, following jumps,
+// subroutine calls and skips to tell instructions from data.
+type disassembler struct {
+	rom   []byte
+	start uint16
+
+	code     map[uint16]bool // Addresses of reachable instructions
+	claimed  []bool          // Bytes occupied by reachable instructions
+	jumps    map[uint16]bool // Targets of jmp instructions
+	calls    map[uint16]bool // Targets of jsr instructions
+	dataRefs map[uint16]bool // Targets of mvi instructions
+	labels   map[uint16]string
+}
+
+// Disassemble disassembles a program loaded at vm.ProgramStart.
+func Disassemble(rom []byte) []Line {
+	d := &disassembler{
+		rom:      rom,
+		start:    vm.ProgramStart,
+		code:     make(map[uint16]bool),
+		claimed:  make([]bool, len(rom)),
+		jumps:    make(map[uint16]bool),
+		calls:    make(map[uint16]bool),
+		dataRefs: make(map[uint16]bool),
+	}
+
+	d.traverse()
+	return d.listing()
+}
+
+func (d *disassembler) inImage(addr uint16) bool {
+	return addr >= d.start && int(addr-d.start) < len(d.rom)
+}
+
+func (d *disassembler) opcode(addr uint16) (uint16, bool) {
+	if !d.inImage(addr) || !d.inImage(addr+1) {
+		return 0, false
+	}
+
+	i := addr - d.start
+	return uint16(d.rom[i])<<8 | uint16(d.rom[i+1]), true
+}
+
+// size returns the size of the instruction at addr.
+func (d *disassembler) size(addr uint16) uint16 {
+	if opcode, _ := d.opcode(addr); opcode == 0xF000 {
+		return 2 * vm.InstructionSize
+	}
+
+	return vm.InstructionSize
+}
+
+func (d *disassembler) traverse() {
+	queue := []uint16{d.start}
+
+	for len(queue) > 0 {
+		addr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for {
+			if d.code[addr] {
+				break
+			}
+
+			opcode, ok := d.opcode(addr)
+			if !ok || !vm.IsKnownOpcode(opcode) {
+				break
+			}
+
+			size := d.size(addr)
+			if opcode == 0xF000 && !d.inImage(addr+size-1) {
+				break
+			}
+
+			d.code[addr] = true
+			for i := uint16(0); i < size; i++ {
+				d.claimed[addr+i-d.start] = true
+			}
+
+			next := addr + size
+			switch {
+			case opcode == 0x00EE || opcode == 0x00FD:
+				// rts, exit
+				next = 0
+
+			case opcode&0xF000 == 0x1000:
+				// jmp
+				target := opcode & 0x0FFF
+				d.jumps[target] = true
+				queue = append(queue, target)
+				next = 0
+
+			case opcode&0xF000 == 0x2000:
+				// jsr
+				target := opcode & 0x0FFF
+				d.calls[target] = true
+				queue = append(queue, target)
+
+			case opcode&0xF000 == 0xB000:
+				// jmi, the target is not known statically
+				next = 0
+
+			case opcode&0xF000 == 0xA000:
+				// mvi
+				d.dataRefs[opcode&0x0FFF] = true
+
+			case opcode == 0xF000:
+				// mvil
+				target, _ := d.opcode(addr + vm.InstructionSize)
+				d.dataRefs[target] = true
+
+			case isSkip(opcode):
+				queue = append(queue, next+d.size(next))
+			}
+
+			if next == 0 {
+				break
+			}
+			addr = next
+		}
+	}
+}
+
+func (d *disassembler) listing() []Line {
+	// Lay out the lines first, so that labels are only generated for
+	// addresses that start a line
+	var addrs []uint16
+	lineAddrs := make(map[uint16]bool)
+	for i := 0; i < len(d.rom); {
+		addr := d.start + uint16(i)
+		addrs = append(addrs, addr)
+		lineAddrs[addr] = true
+
+		if d.code[addr] {
+			i += int(d.size(addr))
+			continue
+		}
+
+		n := 1
+		for i+n < len(d.rom) && n < maxDataLineSize && !d.claimed[i+n] && !d.isReferenced(addr+uint16(n)) {
+			n++
+		}
+		i += n
+	}
+
+	d.labels = make(map[uint16]string)
+	for _, refs := range []struct {
+		targets map[uint16]bool
+		prefix  string
+	}{
+		{d.dataRefs, "data"},
+		{d.jumps, "loc"},
+		{d.calls, "sub"},
+	} {
+		for addr := range refs.targets {
+			if lineAddrs[addr] {
+				d.labels[addr] = fmt.Sprintf("%s_%04x", refs.prefix, addr)
+			}
+		}
+	}
+
+	var lines []Line
+	for i, addr := range addrs {
+		end := d.start + uint16(len(d.rom))
+		if i+1 < len(addrs) {
+			end = addrs[i+1]
+		}
+
+		bs := d.rom[addr-d.start : end-d.start]
+		line := Line{
+			Addr:   addr,
+			Bytes:  bs,
+			Label:  d.labels[addr],
+			IsCode: d.code[addr],
+		}
+
+		if line.IsCode {
+			line.Text = d.instructionText(addr)
+		} else {
+			line.Text = dataText(bs)
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (d *disassembler) isReferenced(addr uint16) bool {
+	return d.jumps[addr] || d.calls[addr] || d.dataRefs[addr] || d.code[addr]
+}
+
+// instructionText returns the mnemonic of the instruction at addr,
+// with target addresses replaced with labels.
+func (d *disassembler) instructionText(addr uint16) string {
+	opcode, _ := d.opcode(addr)
+
+	if opcode == 0xF000 {
+		target, _ := d.opcode(addr + vm.InstructionSize)
+		return "mvil " + d.addrText(target)
+	}
+
+	text := vm.Disassemble(opcode)
+
+	// Opcodes with bits ignored by the VM are printed as data,
+	// so that the listing assembles back into the same bytes
+	if bs, err := asm.Encode(text); err != nil || uint16(bs[0])<<8|uint16(bs[1]) != opcode {
+		return fmt.Sprintf("dw 0x%04x", opcode)
+	}
+
+	switch opcode & 0xF000 {
+	case 0x1000, 0x2000, 0xA000:
+		target := opcode & 0x0FFF
+		text = strings.Replace(text, fmt.Sprintf("0x%04x", target), d.addrText(target), 1)
+	}
+
+	return text
+}
+
+func (d *disassembler) addrText(addr uint16) string {
+	if label, ok := d.labels[addr]; ok {
+		return label
+	}
+
+	return fmt.Sprintf("0x%04x", addr)
+}
+
+func dataText(bs []byte) string {
+	values := make([]string, len(bs))
+	for i, b := range bs {
+		values[i] = fmt.Sprintf("0x%02x", b)
+	}
+
+	return "db " + strings.Join(values, ", ")
+}
+
+// isSkip returns true for instructions that conditionally skip the next one.
+func isSkip(opcode uint16) bool {
+	switch opcode & 0xF000 {
+	case 0x3000, 0x4000:
+		return true
+	case 0x5000, 0x9000:
+		return opcode&0x000F == 0
+	case 0xE000:
+		return opcode&0x00FF == 0x009E || opcode&0x00FF == 0x00A1
+	}
+
+	return false
+}
+
+// Write prints a listing. Addresses and raw bytes are printed as comments,
+// so that the listing can be fed back to the assembler.
+func Write(w io.Writer, lines []Line) error {
+	for _, line := range lines {
+		if line.Label != "" {
+			if _, err := fmt.Fprintf(w, "\n%s:\n", line.Label); err != nil {
+				return err
+			}
+		}
+
+		raw := make([]string, len(line.Bytes))
+		for i, b := range line.Bytes {
+			raw[i] = fmt.Sprintf("%02x", b)
+		}
+
+		if _, err := fmt.Fprintf(w, "    %-36s ; %04x: %s\n", line.Text, line.Addr, strings.Join(raw, " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package disasm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/asm"
+	"github.com/kapitanov/chip8vm/internal/disasm"
+)
+
+// TestRoundTrip disassembles every ROM of the repository, assembles the
+// listing back and compares the result with the ROM.
+func TestRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("../../roms/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		switch filepath.Ext(path) {
+		case ".json", ".txt":
+			continue
+		}
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			rom, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var listing bytes.Buffer
+			if err := disasm.Write(&listing, disasm.Disassemble(rom)); err != nil {
+				t.Fatal(err)
+			}
+
+			src := filepath.Join(t.TempDir(), "rom.s")
+			if err := os.WriteFile(src, listing.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			program, err := asm.Assemble(src)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, listing.Bytes())
+			}
+
+			if !bytes.Equal(program, rom) {
+				t.Errorf("assembled program differs from the ROM:\n%s", listing.Bytes())
+			}
+		})
+	}
+}
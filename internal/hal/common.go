@@ -0,0 +1,116 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kapitanov/chip8vm/internal/audio"
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+type Options struct {
+	OnSaveState  func(slot int) // Called when F1-F4 is pressed
+	OnLoadState  func(slot int) // Called when Shift+F1-F4 is pressed
+	OnRewind     func()         // Called once per frame while Tab is held
+	OnScreenshot func()         // Called when F12 is pressed
+
+	// KeyReleaseTimeout is the time after which a key is considered released
+	// if the terminal doesn't report it again. Terminal only.
+	KeyReleaseTimeout time.Duration
+
+	// Palette is the palette of the screen, palette.Default if nil.
+	Palette *palette.Palette
+
+	// FrameSync presents the screen once per frame instead of after every
+	// instruction changing it. The terminal always does so.
+	FrameSync bool
+
+	// Phosphor is the decay of the phosphor filter from 0 to 1, the filter
+	// is disabled if zero.
+	Phosphor float64
+
+	// ScaleMode is the way the screen is scaled to the window. SDL only.
+	ScaleMode ScaleMode
+
+	// Fullscreen starts in fullscreen mode, F11 toggles it. SDL only.
+	Fullscreen bool
+
+	// Keymap maps keys and gamepad buttons, keymap.Default() if empty.
+	// Gamepads are supported by SDL only.
+	Keymap keymap.Keymap
+
+	// Sound is the sound of the buzzer. SDL only, the terminal rings its bell.
+	Sound audio.Config
+}
+
+// ScaleMode is the way the screen is scaled to the window,
+// the aspect ratio is kept in both modes.
+type ScaleMode int
+
+const (
+	// ScaleInteger scales pixels by an integer factor, so that all of them
+	// are of the same size.
+	ScaleInteger ScaleMode = iota
+
+	// ScaleFit scales the screen to fit the window, filling as much of it
+	// as possible.
+	ScaleFit
+)
+
+func (m ScaleMode) String() string {
+	switch m {
+	case ScaleInteger:
+		return "integer"
+	case ScaleFit:
+		return "fit"
+	default:
+		return fmt.Sprintf("ScaleMode(%d)", int(m))
+	}
+}
+
+func ParseScaleMode(name string) (ScaleMode, error) {
+	for _, m := range []ScaleMode{ScaleInteger, ScaleFit} {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown scale mode %q, expected one of: %s, %s", name, ScaleInteger, ScaleFit)
+}
+
+var (
+	ErrReboot = errors.New("reboot")
+	ErrQuit   = errors.New("quit")
+)
+
+func newPhosphor(options Options) *palette.Phosphor {
+	if options.Phosphor <= 0 {
+		return nil
+	}
+
+	return palette.NewPhosphor(options.Palette, options.Phosphor)
+}
+
+// frameClock paces frames at vm.FrameRate.
+type frameClock struct {
+	nextFrame time.Time
+}
+
+func (c *frameClock) wait() {
+	const frameDuration = time.Second / vm.FrameRate
+
+	now := time.Now()
+	if c.nextFrame.IsZero() || now.Sub(c.nextFrame) > frameDuration {
+		// Either the first frame or we've fallen too far behind to catch up
+		c.nextFrame = now
+	}
+
+	if delay := c.nextFrame.Sub(now); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	c.nextFrame = c.nextFrame.Add(frameDuration)
+}
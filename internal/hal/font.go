@@ -0,0 +1,80 @@
+package hal
+
+import "unicode"
+
+const (
+	// glyphWidth and glyphHeight are the size of a character cell in pixels,
+	// including a column and a row of spacing.
+	glyphWidth  = 4
+	glyphHeight = 6
+)
+
+// glyphs is a 3x5 pixel font, rows are top to bottom with the leftmost
+// pixel in bit 2. Lowercase letters are drawn as uppercase ones, except x
+// which is common in hex numbers.
+var glyphs = map[rune][5]uint8{
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7}, 'x': {0, 5, 2, 5, 0},
+
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {6, 1, 2, 4, 7}, '3': {6, 1, 2, 1, 6},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 6, 1, 6}, '6': {3, 4, 7, 5, 7}, '7': {7, 1, 2, 2, 2},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 6},
+
+	' ': {0, 0, 0, 0, 0}, '.': {0, 0, 0, 0, 2}, ',': {0, 0, 0, 2, 4}, ':': {0, 2, 0, 2, 0},
+	'(': {1, 2, 2, 2, 1}, ')': {4, 2, 2, 2, 4}, '[': {3, 2, 2, 2, 3}, ']': {6, 2, 2, 2, 6},
+	'=': {0, 7, 0, 7, 0}, '-': {0, 0, 7, 0, 0}, '+': {0, 2, 7, 2, 0}, '/': {1, 1, 2, 4, 4},
+	'_': {0, 0, 0, 0, 7}, '\'': {2, 2, 0, 0, 0}, '"': {5, 5, 0, 0, 0}, '!': {2, 2, 2, 0, 2},
+	'?': {6, 1, 2, 0, 2}, '#': {5, 7, 5, 7, 5},
+}
+
+// drawText draws a line of text into a buffer of pixels width pixels wide,
+// with each pixel of the font scaled up to a square of scale pixels.
+func drawText(buf []uint32, width int, x, y int, text string, color uint32, scale int) {
+	for _, r := range text {
+		glyph, ok := glyphs[r]
+		if !ok {
+			glyph, ok = glyphs[unicode.ToUpper(r)]
+		}
+		if !ok {
+			glyph = glyphs['?']
+		}
+
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+
+				for i := 0; i < scale*scale; i++ {
+					px := x + col*scale + i%scale
+					py := y + row*scale + i/scale
+					if px < width && py*width+px < len(buf) {
+						buf[py*width+px] = color
+					}
+				}
+			}
+		}
+
+		x += glyphWidth * scale
+	}
+}
+
+// wrapText splits lines longer than n characters.
+func wrapText(lines []string, n int) []string {
+	var wrapped []string
+	for _, line := range lines {
+		runes := []rune(line)
+		for len(runes) > n {
+			wrapped = append(wrapped, string(runes[:n]))
+			runes = runes[n:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+
+	return wrapped
+}
@@ -1,46 +1,77 @@
+//go:build cgo
+
 package hal
 
 import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"math"
-	"time"
 	"unsafe"
 
-	"github.com/kapitanov/chip8vm/internal/vm"
+	"github.com/kapitanov/chip8vm/internal/audio"
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
+	// WindowWidth and WindowHeight are the initial size of the window,
+	// it can be resized later.
 	WindowWidth  = 1024
 	WindowHeight = 512
 
-	AudioFrequency = 16000
-	AudioToneHZ    = 440.0
-	AudioDuration  = 0.25
+	// maxQueuedAudio is the amount of audio queued ahead, in frames. Frames
+	// beyond it are dropped, so that the sound doesn't lag behind the VM.
+	maxQueuedAudio = 4
+
+	// crashScreenScale is the size of the crash screen relative to
+	// the high resolution screen, crashFontScale is the size of a pixel
+	// of the font on it.
+	crashScreenScale = 4
+	crashFontScale   = 2
 )
 
 type HAL struct {
+	options         Options
 	window          *sdl.Window
 	renderer        *sdl.Renderer
 	texture         *sdl.Texture
+	framebuffer     vm.Framebuffer // Last drawn screen
+	dirty           bool           // Indicates the screen has been drawn but not presented
+	phosphor        *palette.Phosphor
 	backBuffer      []uint32
 	backBufferPitch int
 	audio           sdl.AudioDeviceID
+	synth           *audio.Synth
+	samples         []byte
+	clock           frameClock
+	rewinding       bool
+	fullscreen      bool
+	keys            map[sdl.Keycode]keymap.Target
+	buttons         map[uint8]keymap.Target
+	controllers     map[sdl.JoystickID]*sdl.GameController
 }
 
-var (
-	ErrReboot = errors.New("reboot")
-	ErrQuit   = errors.New("quit")
-)
+func New(options Options) (*HAL, error) {
+	if options.Keymap.Keys == nil {
+		options.Keymap = keymap.Default()
+	}
+
+	if options.Palette == nil {
+		options.Palette = &palette.Default
+	}
 
-func New() (*HAL, error) {
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
 		return nil, fmt.Errorf("failed to init sdl: %w", err)
 	}
 
-	window, err := sdl.CreateWindow("CHIP-8", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, WindowWidth, WindowHeight, sdl.WINDOW_SHOWN)
+	var windowFlags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_RESIZABLE
+	if options.Fullscreen {
+		windowFlags |= sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+
+	window, err := sdl.CreateWindow("CHIP-8", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, WindowWidth, WindowHeight, windowFlags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sdl window: %w", err)
 	}
@@ -50,38 +81,85 @@ func New() (*HAL, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sdl renderer: %w", err)
 	}
-	err = renderer.SetLogicalSize(WindowWidth, WindowHeight)
+	// The logical size keeps the aspect ratio, letterboxing the screen
+	// if the window is wider or taller
+	err = renderer.SetLogicalSize(vm.HiResScreenWidth, vm.HiResScreenHeight)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resize sdl renderer: %w", err)
 	}
+	err = renderer.SetIntegerScale(options.ScaleMode == ScaleInteger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set sdl renderer scale: %w", err)
+	}
 
-	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, vm.ScreenWidth, vm.ScreenHeight)
+	// Fill the borders around the screen with the background color
+	bg := options.Palette.Color(0)
+	err = renderer.SetDrawColor(bg.R, bg.G, bg.B, bg.A)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set sdl renderer color: %w", err)
+	}
+
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, vm.HiResScreenWidth, vm.HiResScreenHeight)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sdl texture: %w", err)
 	}
 
 	audioSpec := &sdl.AudioSpec{
-		Freq:     AudioFrequency,
-		Format:   sdl.AUDIO_S16SYS,
+		Freq:     audio.SampleRate,
+		Format:   sdl.AUDIO_S16LSB,
 		Channels: 1,
-		Samples:  1024,
+		Samples:  512,
 	}
-	audio, err := sdl.OpenAudioDevice("", false, audioSpec, nil, 0)
+	audioDevice, err := sdl.OpenAudioDevice("", false, audioSpec, nil, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open audio device: %w", err)
 	}
+	sdl.PauseAudioDevice(audioDevice, false)
 
 	return &HAL{
+		options:         options,
 		window:          window,
+		fullscreen:      options.Fullscreen,
 		renderer:        renderer,
 		texture:         texture,
-		backBuffer:      make([]uint32, vm.ScreenWidth*vm.ScreenHeight),
-		backBufferPitch: int(vm.ScreenWidth) * int(unsafe.Sizeof(uint32(0))),
-		audio:           audio,
+		backBuffer:      make([]uint32, vm.HiResScreenWidth*vm.HiResScreenHeight),
+		backBufferPitch: int(vm.HiResScreenWidth) * int(unsafe.Sizeof(uint32(0))),
+		audio:           audioDevice,
+		synth:           audio.NewSynth(options.Sound),
+		keys:            sdlKeys(options.Keymap),
+		buttons:         sdlButtons(options.Keymap),
+		controllers:     make(map[sdl.JoystickID]*sdl.GameController),
+		phosphor:        newPhosphor(options),
 	}, nil
 }
 
+// sdlKeys maps key codes to targets. SDL recognizes keys named by their
+// characters as well as its own key names, e.g. "keypad 5".
+func sdlKeys(m keymap.Keymap) map[sdl.Keycode]keymap.Target {
+	keys := make(map[sdl.Keycode]keymap.Target)
+	for name, target := range m.Keys {
+		if name == "enter" {
+			name = "return"
+		}
+
+		code := sdl.GetKeyFromName(name)
+
+		if code == sdl.K_UNKNOWN {
+			slog.Warn("unknown key in keymap", "key", name)
+			continue
+		}
+
+		keys[code] = target
+	}
+
+	return keys
+}
+
 func (hal *HAL) Shutdown() {
+	for _, controller := range hal.controllers {
+		controller.Close()
+	}
+
 	if err := hal.texture.Destroy(); err != nil {
 		slog.Error("failed to destroy sdl texture", "err", err)
 	}
@@ -97,6 +175,22 @@ func (hal *HAL) Shutdown() {
 	sdl.Quit()
 }
 
+// sdlButtons maps gamepad buttons to targets.
+func sdlButtons(m keymap.Keymap) map[uint8]keymap.Target {
+	buttons := make(map[uint8]keymap.Target)
+	for name, target := range m.Buttons {
+		button := sdl.GameControllerGetButtonFromString(name)
+		if button == sdl.CONTROLLER_BUTTON_INVALID {
+			slog.Warn("unknown gamepad button in keymap", "button", name)
+			continue
+		}
+
+		buttons[uint8(button)] = target
+	}
+
+	return buttons
+}
+
 func (hal *HAL) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
 	for e := sdl.PollEvent(); e != nil; e = sdl.PollEvent() {
 		switch e.GetType() {
@@ -110,97 +204,205 @@ func (hal *HAL) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
 			}
 
 		case sdl.KEYUP:
-			hal.processKeyUp(e.(*sdl.KeyboardEvent), keyUp)
+			if target, ok := hal.keys[e.(*sdl.KeyboardEvent).Keysym.Sym]; ok {
+				hal.releaseTarget(target, keyUp)
+			}
+
+		case sdl.WINDOWEVENT:
+			switch e.(*sdl.WindowEvent).Event {
+			case sdl.WINDOWEVENT_EXPOSED, sdl.WINDOWEVENT_SIZE_CHANGED:
+				if err := hal.present(); err != nil {
+					return err
+				}
+			}
+
+		case sdl.CONTROLLERDEVICEADDED, sdl.CONTROLLERDEVICEREMOVED:
+			hal.processControllerDevice(e.(*sdl.ControllerDeviceEvent))
+
+		case sdl.CONTROLLERBUTTONDOWN, sdl.CONTROLLERBUTTONUP:
+			e := e.(*sdl.ControllerButtonEvent)
+			target, ok := hal.buttons[e.Button]
+			if !ok {
+				break
+			}
+
+			if e.Type == sdl.CONTROLLERBUTTONUP {
+				hal.releaseTarget(target, keyUp)
+			} else if err := hal.pressTarget(target, keyDown); err != nil {
+				return err
+			}
 		}
 	}
 
+	if hal.rewinding && hal.options.OnRewind != nil {
+		hal.options.OnRewind()
+	}
+
 	return nil
 }
 
 func (hal *HAL) processKeyDown(e *sdl.KeyboardEvent, callback func(vm.Key)) error {
-	if e.Keysym.Scancode == sdl.SCANCODE_BACKSPACE {
-		return ErrReboot
+	if e.Keysym.Scancode == sdl.SCANCODE_F12 {
+		if e.Repeat == 0 && hal.options.OnScreenshot != nil {
+			hal.options.OnScreenshot()
+		}
+		return nil
 	}
 
-	key, ok := keyMap(e)
-	if ok {
-		callback(key)
+	if e.Keysym.Scancode == sdl.SCANCODE_F11 {
+		if e.Repeat == 0 {
+			hal.toggleFullscreen()
+		}
+		return nil
+	}
+
+	if slot, ok := stateSlot(e); ok {
+		if e.Repeat == 0 {
+			hal.processStateSlot(e, slot)
+		}
+		return nil
+	}
+
+	if target, ok := hal.keys[e.Keysym.Sym]; ok {
+		return hal.pressTarget(target, callback)
+	}
+
+	return nil
+}
+
+func (hal *HAL) pressTarget(target keymap.Target, callback func(vm.Key)) error {
+	switch target {
+	case keymap.Reboot:
+		return ErrReboot
+	case keymap.Rewind:
+		hal.rewinding = true
+	default:
+		if key, ok := target.Key(); ok {
+			callback(key)
+		}
 	}
 
 	return nil
 }
 
-func (hal *HAL) processKeyUp(e *sdl.KeyboardEvent, callback func(vm.Key)) {
-	key, ok := keyMap(e)
-	if ok {
+func (hal *HAL) releaseTarget(target keymap.Target, callback func(vm.Key)) {
+	if target == keymap.Rewind {
+		hal.rewinding = false
+		return
+	}
+
+	if key, ok := target.Key(); ok {
 		callback(key)
 	}
 }
 
-func keyMap(e *sdl.KeyboardEvent) (vm.Key, bool) {
-	// Physical                Logical
-	// ================        =================
-	// | 1 | 2 | 3 | 4 |       | 1 | 2 | 3 | C |
-	// | q | w | e | r |       | 4 | 5 | 6 | D |
-	// | a | s | d | e |  <=>  | 7 | 8 | 9 | E |
-	// | z | x | c | v |       | A | 0 | B | F |
-	// ================        =================
+// processControllerDevice opens gamepads as they are connected,
+// including the ones connected before the start.
+func (hal *HAL) processControllerDevice(e *sdl.ControllerDeviceEvent) {
+	if e.Type == sdl.CONTROLLERDEVICEREMOVED {
+		if controller, ok := hal.controllers[e.Which]; ok {
+			controller.Close()
+			delete(hal.controllers, e.Which)
+		}
+		return
+	}
+
+	controller := sdl.GameControllerOpen(int(e.Which))
+	if controller == nil {
+		slog.Error("failed to open gamepad", "err", sdl.GetError())
+		return
+	}
+
+	slog.Info("gamepad connected", "name", controller.Name())
+	hal.controllers[controller.Joystick().InstanceID()] = controller
+}
+
+func (hal *HAL) toggleFullscreen() {
+	var flags uint32
+	if !hal.fullscreen {
+		flags = sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+
+	if err := hal.window.SetFullscreen(flags); err != nil {
+		slog.Error("failed to toggle fullscreen", "err", err)
+		return
+	}
+
+	hal.fullscreen = !hal.fullscreen
+}
 
+func (hal *HAL) processStateSlot(e *sdl.KeyboardEvent, slot int) {
+	callback := hal.options.OnSaveState
+	if e.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+		callback = hal.options.OnLoadState
+	}
+
+	if callback != nil {
+		callback(slot)
+	}
+}
+
+func stateSlot(e *sdl.KeyboardEvent) (int, bool) {
 	switch e.Keysym.Scancode {
-	case sdl.SCANCODE_X:
-		return vm.Key0, true
-	case sdl.SCANCODE_1:
-		return vm.Key1, true
-	case sdl.SCANCODE_2:
-		return vm.Key2, true
-	case sdl.SCANCODE_3:
-		return vm.Key3, true
-	case sdl.SCANCODE_Q:
-		return vm.Key4, true
-	case sdl.SCANCODE_W:
-		return vm.Key5, true
-	case sdl.SCANCODE_E:
-		return vm.Key6, true
-	case sdl.SCANCODE_A:
-		return vm.Key7, true
-	case sdl.SCANCODE_S:
-		return vm.Key8, true
-	case sdl.SCANCODE_D:
-		return vm.Key9, true
-	case sdl.SCANCODE_Z:
-		return vm.KeyA, true
-	case sdl.SCANCODE_C:
-		return vm.KeyB, true
-	case sdl.SCANCODE_4:
-		return vm.KeyC, true
-	case sdl.SCANCODE_R:
-		return vm.KeyD, true
-	case sdl.SCANCODE_F:
-		return vm.KeyE, true
-	case sdl.SCANCODE_V:
-		return vm.KeyF, true
+	case sdl.SCANCODE_F1:
+		return 1, true
+	case sdl.SCANCODE_F2:
+		return 2, true
+	case sdl.SCANCODE_F3:
+		return 3, true
+	case sdl.SCANCODE_F4:
+		return 4, true
 	default:
 		return 0, false
 	}
 }
 
-func (hal *HAL) Draw(gfx []uint8) error {
-	const (
-		bgColor = uint32(0x000000)
-		fgColor = uint32(0xbea700)
-	)
+// Draw presents the screen right away unless it's presented at frame
+// boundaries, which is always the case with the phosphor filter.
+func (hal *HAL) Draw(fb vm.Framebuffer) error {
+	hal.framebuffer.Width = fb.Width
+	hal.framebuffer.Height = fb.Height
+	hal.framebuffer.Pixels = append(hal.framebuffer.Pixels[:0], fb.Pixels...)
+	hal.dirty = true
 
-	for y := 0; y < vm.ScreenHeight; y++ {
+	if hal.options.FrameSync || hal.phosphor != nil {
+		return nil
+	}
+
+	return hal.render()
+}
 
-		for x := 0; x < vm.ScreenWidth; x++ {
-			i := x + y*vm.ScreenWidth
+func (hal *HAL) render() error {
+	hal.dirty = false
 
-			color := bgColor
-			if gfx[i] != 0 {
-				color = fgColor
-			}
+	fb := hal.framebuffer
+	if fb.Width == 0 {
+		// Nothing has been drawn yet
+		return nil
+	}
 
-			hal.backBuffer[i] = color
+	var rgb []uint32
+	if hal.phosphor != nil {
+		var changed bool
+		if rgb, changed = hal.phosphor.Apply(fb); !changed {
+			return nil
+		}
+	}
+
+	// The back buffer is always high resolution, low resolution
+	// frames are scaled up to fill it
+	scaleX := vm.HiResScreenWidth / fb.Width
+	scaleY := vm.HiResScreenHeight / fb.Height
+
+	for y := 0; y < vm.HiResScreenHeight; y++ {
+		for x := 0; x < vm.HiResScreenWidth; x++ {
+			i := x/scaleX + (y/scaleY)*fb.Width
+
+			if rgb != nil {
+				hal.backBuffer[x+y*vm.HiResScreenWidth] = rgb[i]
+			} else {
+				hal.backBuffer[x+y*vm.HiResScreenWidth] = hal.options.Palette.RGB(fb.Pixels[i])
+			}
 		}
 	}
 
@@ -209,6 +411,11 @@ func (hal *HAL) Draw(gfx []uint8) error {
 		return fmt.Errorf("failed to update sdl texture: %w", err)
 	}
 
+	return hal.present()
+}
+
+// present draws the texture to the window, scaled up to its size.
+func (hal *HAL) present() error {
 	if err := hal.renderer.Clear(); err != nil {
 		return fmt.Errorf("failed to clear sdl renderer: %w", err)
 	}
@@ -221,46 +428,148 @@ func (hal *HAL) Draw(gfx []uint8) error {
 	return nil
 }
 
-func (hal *HAL) Beep() error {
-	const (
-		sampleCount = int(AudioDuration * AudioFrequency)
-		gain        = float64(math.MaxInt16)
-	)
-
-	timeStep := 1.0 / float64(sampleCount)
-
-	t := 0.0
-	var sample int16
-	sampleSize := int(unsafe.Sizeof(sample))
-	samples := make([]byte, sampleCount*sampleSize)
+// Sound queues the samples of a frame while the buzzer sounds. Silence isn't
+// queued, the device plays it once the queue runs out.
+func (hal *HAL) Sound(on bool, pattern *vm.AudioPattern) error {
+	samples := hal.synth.Frame(on, pattern)
+	if !on {
+		return nil
+	}
 
-	for i := 0; i < sampleCount; i++ {
-		t += timeStep
-		sample := int16(math.Sin(2*math.Pi*AudioToneHZ*t) * gain)
-		samples[2*i+0] = byte(sample >> 8)
-		samples[2*i+1] = byte(sample & 0xFF)
+	if sdl.GetQueuedAudioSize(hal.audio) > maxQueuedAudio*audio.SamplesPerFrame*2 {
+		return nil
 	}
 
-	if err := sdl.QueueAudio(hal.audio, samples); err != nil {
+	hal.samples = audio.Bytes(samples, hal.samples)
+	if err := sdl.QueueAudio(hal.audio, hal.samples); err != nil {
 		return fmt.Errorf("failed to queue audio: %w", err)
 	}
 
-	sdl.PauseAudioDevice(hal.audio, false)
 	return nil
 }
 
 func (hal *HAL) WaitForNextFrame() error {
-	const delayDuration = 1200 * time.Microsecond
-	time.Sleep(delayDuration)
+	// The phosphor keeps fading even if nothing is drawn
+	if hal.phosphor != nil || (hal.dirty && hal.options.FrameSync) {
+		if err := hal.render(); err != nil {
+			return err
+		}
+	}
+
+	hal.clock.wait()
 	return nil
 }
 
-func (hal *HAL) WaitForQuit() error {
+// ShowCrash replaces the screen with a report of a crashed program and
+// waits for the user to either reset the VM (ErrReboot) or quit (ErrQuit).
+func (hal *HAL) ShowCrash(lines []string) error {
+	sdl.ClearQueuedAudio(hal.audio)
+
+	width := vm.HiResScreenWidth * crashScreenScale
+	height := vm.HiResScreenHeight * crashScreenScale
+	texture, err := hal.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STATIC, int32(width), int32(height))
+	if err != nil {
+		return fmt.Errorf("failed to create sdl texture: %w", err)
+	}
+	defer texture.Destroy()
+
+	pixels := make([]uint32, width*height)
+	for i := range pixels {
+		pixels[i] = hal.options.Palette.RGB(0)
+	}
+
+	lines = append(lines, "", "ENTER: RESET    ESC: QUIT")
+	margin := glyphWidth * crashFontScale
+	columns := (width - 2*margin) / (glyphWidth * crashFontScale)
+	for i, line := range wrapText(lines, columns) {
+		y := margin + i*glyphHeight*crashFontScale
+		drawText(pixels, width, margin, y, line, hal.options.Palette.RGB(1), crashFontScale)
+	}
+
+	pitch := width * int(unsafe.Sizeof(uint32(0)))
+	if err := texture.Update(nil, unsafe.Pointer(&pixels[0]), pitch); err != nil {
+		return fmt.Errorf("failed to update sdl texture: %w", err)
+	}
+
+	present := func() error {
+		if err := hal.renderer.Clear(); err != nil {
+			return fmt.Errorf("failed to clear sdl renderer: %w", err)
+		}
+
+		if err := hal.renderer.Copy(texture, nil, nil); err != nil {
+			return fmt.Errorf("failed to copy sdl texture to renderer: %w", err)
+		}
+
+		hal.renderer.Present()
+		return nil
+	}
+
+	if err := present(); err != nil {
+		return err
+	}
+
 	for {
-		for e := sdl.PollEvent(); e != nil; e = sdl.PollEvent() {
-			if e.GetType() == sdl.QUIT {
-				return nil
+		err := hal.readCrashInput(present)
+		if errors.Is(err, ErrReboot) {
+			// Bring the screen of the VM back, the program may not clear it
+			if err := hal.present(); err != nil {
+				return err
 			}
+			return ErrReboot
+		}
+
+		if err != nil {
+			return err
 		}
+
+		hal.clock.wait()
 	}
 }
+
+// readCrashInput handles events while the crash screen is shown. Enter or
+// the reboot key resets the VM, Esc or closing the window quits.
+func (hal *HAL) readCrashInput(present func() error) error {
+	for e := sdl.PollEvent(); e != nil; e = sdl.PollEvent() {
+		switch e.GetType() {
+		case sdl.QUIT:
+			return ErrQuit
+
+		case sdl.KEYDOWN:
+			e := e.(*sdl.KeyboardEvent)
+			if e.Repeat != 0 {
+				break
+			}
+
+			if e.Keysym.Scancode == sdl.SCANCODE_F11 {
+				hal.toggleFullscreen()
+				break
+			}
+
+			if e.Keysym.Sym == sdl.K_ESCAPE {
+				return ErrQuit
+			}
+
+			if target, ok := hal.keys[e.Keysym.Sym]; e.Keysym.Sym == sdl.K_RETURN || (ok && target == keymap.Reboot) {
+				return ErrReboot
+			}
+
+		case sdl.WINDOWEVENT:
+			switch e.(*sdl.WindowEvent).Event {
+			case sdl.WINDOWEVENT_EXPOSED, sdl.WINDOWEVENT_SIZE_CHANGED:
+				if err := present(); err != nil {
+					return err
+				}
+			}
+
+		case sdl.CONTROLLERDEVICEADDED, sdl.CONTROLLERDEVICEREMOVED:
+			hal.processControllerDevice(e.(*sdl.ControllerDeviceEvent))
+
+		case sdl.CONTROLLERBUTTONDOWN:
+			if target, ok := hal.buttons[e.(*sdl.ControllerButtonEvent).Button]; ok && target == keymap.Reboot {
+				return ErrReboot
+			}
+		}
+	}
+
+	return nil
+}
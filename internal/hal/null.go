@@ -0,0 +1,33 @@
+package hal
+
+import "github.com/kapitanov/chip8vm/vm"
+
+// Null is a HAL without a screen, sound or input, it only paces frames.
+// It runs the VM where neither a window nor the terminal can be used,
+// e.g. under the debugger, which reads commands from the terminal.
+type Null struct {
+	clock frameClock
+}
+
+func NewNull(_ Options) (*Null, error) {
+	return &Null{}, nil
+}
+
+func (hal *Null) Shutdown() {}
+
+func (hal *Null) Draw(_ vm.Framebuffer) error {
+	return nil
+}
+
+func (hal *Null) Sound(_ bool, _ *vm.AudioPattern) error {
+	return nil
+}
+
+func (hal *Null) ReadInput(_ func(vm.Key), _ func(vm.Key)) error {
+	return nil
+}
+
+func (hal *Null) WaitForNextFrame() error {
+	hal.clock.wait()
+	return nil
+}
@@ -0,0 +1,480 @@
+package hal
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// DefaultKeyReleaseTimeout is long enough to bridge the delay before
+// a terminal starts repeating a held key.
+const DefaultKeyReleaseTimeout = 200 * time.Millisecond
+
+// Terminal is a HAL drawing the screen in a terminal with ANSI colors,
+// two pixels per character cell, and reading keys from a raw-mode TTY.
+// Terminals don't report key releases, so a key is released once it
+// hasn't been repeated for Options.KeyReleaseTimeout.
+type Terminal struct {
+	options Options
+	in      *os.File
+	out     *os.File
+	restore func() error
+	input   chan []byte
+	keys    []terminalKey // Sorted from the longest sequence
+
+	pending     []byte    // Start of an escape sequence split between reads
+	pendingTime time.Time // Time the pending bytes have been read
+
+	pressed     [vm.KeyCount]time.Time // Time a key was last seen, zero if released
+	rewindUntil time.Time
+
+	framebuffer vm.Framebuffer
+	dirty       bool
+	colors      []uint32 // Colors of pixels without the phosphor filter
+	phosphor    *palette.Phosphor
+	buffer      bytes.Buffer
+	clock       frameClock
+	sounding    bool
+}
+
+// escapeTimeout is the time the rest of an escape sequence is waited for,
+// Esc followed by nothing for this long has been pressed by itself.
+const escapeTimeout = 50 * time.Millisecond
+
+const (
+	ansiEnterAltScreen = "\x1b[?1049h\x1b[?25l\x1b[2J"
+	ansiLeaveAltScreen = "\x1b[0m\x1b[?25h\x1b[?1049l"
+	ansiClear          = "\x1b[0m\x1b[2J"
+	ansiHome           = "\x1b[H"
+	ansiReset          = "\x1b[0m"
+	ansiBell           = "\a"
+	ansiF12            = "\x1b[24~"
+	upperHalfBlock     = "▀"
+)
+
+// terminalKey is an input sequence of a key.
+type terminalKey struct {
+	seq    string
+	target keymap.Target
+}
+
+// terminalKeyNames are input sequences of special keys.
+var terminalKeyNames = map[string][]string{
+	"space":     {" "},
+	"enter":     {"\r"},
+	"tab":       {"\t"},
+	"backspace": {"\x7f", "\x08"},
+	"up":        {"\x1b[A", "\x1bOA"},
+	"down":      {"\x1b[B", "\x1bOB"},
+	"right":     {"\x1b[C", "\x1bOC"},
+	"left":      {"\x1b[D", "\x1bOD"},
+}
+
+func NewTerminal(options Options) (*Terminal, error) {
+	if options.KeyReleaseTimeout <= 0 {
+		options.KeyReleaseTimeout = DefaultKeyReleaseTimeout
+	}
+
+	if options.Keymap.Keys == nil {
+		options.Keymap = keymap.Default()
+	}
+
+	if options.Palette == nil {
+		options.Palette = &palette.Default
+	}
+
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+
+	hal := &Terminal{
+		options:  options,
+		in:       os.Stdin,
+		out:      os.Stdout,
+		restore:  restore,
+		input:    make(chan []byte, 64),
+		keys:     terminalKeys(options.Keymap),
+		phosphor: newPhosphor(options),
+	}
+
+	go hal.readInput()
+
+	if _, err = hal.out.WriteString(ansiEnterAltScreen); err != nil {
+		hal.Shutdown()
+		return nil, fmt.Errorf("failed to write to terminal: %w", err)
+	}
+
+	return hal, nil
+}
+
+// terminalKeys returns input sequences of keys, letters are matched
+// regardless of case as Shift or Caps Lock may be on.
+func terminalKeys(m keymap.Keymap) []terminalKey {
+	var keys []terminalKey
+	for name, target := range m.Keys {
+		seqs, ok := terminalKeyNames[name]
+		if !ok {
+			if utf8.RuneCountInString(name) != 1 {
+				slog.Warn("unknown key in keymap", "key", name)
+				continue
+			}
+
+			seqs = []string{name}
+			if upper := strings.ToUpper(name); upper != name {
+				seqs = append(seqs, upper)
+			}
+		}
+
+		for _, seq := range seqs {
+			keys = append(keys, terminalKey{seq: seq, target: target})
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return len(keys[i].seq) > len(keys[j].seq)
+	})
+
+	return keys
+}
+
+func (hal *Terminal) Shutdown() {
+	if _, err := hal.out.WriteString(ansiLeaveAltScreen); err != nil {
+		slog.Error("failed to write to terminal", "err", err)
+	}
+
+	if err := hal.restore(); err != nil {
+		slog.Error("failed to restore terminal mode", "err", err)
+	}
+}
+
+// readInput forwards chunks of input to the channel polled by ReadInput.
+func (hal *Terminal) readInput() {
+	buf := make([]byte, 256)
+	for {
+		n, err := hal.in.Read(buf)
+		if err != nil {
+			close(hal.input)
+			return
+		}
+
+		hal.input <- append([]byte(nil), buf[:n]...)
+	}
+}
+
+func (hal *Terminal) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
+	now := time.Now()
+
+	for {
+		var chunk []byte
+		select {
+		case bs, ok := <-hal.input:
+			if !ok {
+				slog.Debug("hal: input closed")
+				return ErrQuit
+			}
+			chunk = bs
+
+		default:
+		}
+
+		if chunk == nil {
+			break
+		}
+
+		rest, err := hal.processInput(append(hal.pending, chunk...), now, keyDown)
+		if err != nil {
+			return err
+		}
+		hal.pending = append(hal.pending[:0], rest...)
+		hal.pendingTime = now
+	}
+
+	if len(hal.pending) > 0 && now.Sub(hal.pendingTime) > escapeTimeout {
+		lone := len(hal.pending) == 1
+		hal.pending = hal.pending[:0]
+
+		if lone {
+			// A lone Esc, not a part of an escape sequence
+			slog.Debug("hal: exit requested")
+			return ErrQuit
+		}
+	}
+
+	for key, seen := range hal.pressed {
+		if !seen.IsZero() && now.Sub(seen) > hal.options.KeyReleaseTimeout {
+			hal.pressed[key] = time.Time{}
+			keyUp(vm.Key(key))
+		}
+	}
+
+	if now.Before(hal.rewindUntil) && hal.options.OnRewind != nil {
+		hal.options.OnRewind()
+	}
+
+	return nil
+}
+
+// processInput handles the keys of the input, returns the start of an escape
+// sequence at its end to be completed by the next read.
+func (hal *Terminal) processInput(bs []byte, now time.Time, keyDown func(vm.Key)) ([]byte, error) {
+	for len(bs) > 0 {
+		if slot, load, n := terminalStateSlot(bs); n > 0 {
+			callback := hal.options.OnSaveState
+			if load {
+				callback = hal.options.OnLoadState
+			}
+			if callback != nil {
+				callback(slot)
+			}
+
+			bs = bs[n:]
+			continue
+		}
+
+		if bytes.HasPrefix(bs, []byte(ansiF12)) {
+			if hal.options.OnScreenshot != nil {
+				hal.options.OnScreenshot()
+			}
+
+			bs = bs[len(ansiF12):]
+			continue
+		}
+
+		if target, n := hal.matchKey(bs); n > 0 {
+			bs = bs[n:]
+			if err := hal.pressTarget(target, now, keyDown); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch bs[0] {
+		case 0x03, 0x04:
+			// Ctrl+C, Ctrl+D
+			slog.Debug("hal: exit requested")
+			return nil, ErrQuit
+
+		case 0x1b:
+			if len(bs) > 1 && bs[1] == 0x1b {
+				// Esc pressed by itself, followed by another key
+				slog.Debug("hal: exit requested")
+				return nil, ErrQuit
+			}
+
+			n := escapeSequenceLength(bs)
+			if n == 0 {
+				// Wait for the rest of the sequence, or for Esc to time out
+				return bs, nil
+			}
+
+			// Skip unknown escape sequences
+			bs = bs[n:]
+			continue
+		}
+
+		bs = bs[1:]
+	}
+
+	return nil, nil
+}
+
+// escapeSequenceLength returns the length of the escape sequence at the start
+// of the input, or 0 if the input ends before the sequence does: CSI sequences
+// end with a byte from 0x40 to 0x7e, SS3 ones with the byte after "\x1bO",
+// and Esc followed by any other byte is Alt with a key.
+func escapeSequenceLength(bs []byte) int {
+	if len(bs) < 2 {
+		return 0
+	}
+
+	switch bs[1] {
+	case '[':
+		for i := 2; i < len(bs); i++ {
+			switch {
+			case bs[i] >= 0x40 && bs[i] <= 0x7e:
+				return i + 1
+			case bs[i] < 0x20:
+				// Not a valid sequence, leave the control character be
+				return i
+			}
+		}
+		return 0
+
+	case 'O':
+		if len(bs) < 3 {
+			return 0
+		}
+		return 3
+
+	default:
+		return 2
+	}
+}
+
+// matchKey returns the target of the key at the start of the input
+// and the length of its sequence, or 0 if there's no key.
+func (hal *Terminal) matchKey(bs []byte) (keymap.Target, int) {
+	for _, key := range hal.keys {
+		if bytes.HasPrefix(bs, []byte(key.seq)) {
+			return key.target, len(key.seq)
+		}
+	}
+
+	return 0, 0
+}
+
+func (hal *Terminal) pressTarget(target keymap.Target, now time.Time, keyDown func(vm.Key)) error {
+	switch target {
+	case keymap.Reboot:
+		return ErrReboot
+
+	case keymap.Rewind:
+		hal.rewindUntil = now.Add(hal.options.KeyReleaseTimeout)
+
+	default:
+		key, ok := target.Key()
+		if !ok {
+			return nil
+		}
+
+		if hal.pressed[key].IsZero() {
+			keyDown(key)
+		}
+		hal.pressed[key] = now
+	}
+
+	return nil
+}
+
+// terminalStateSlot recognizes xterm escape sequences of F1-F4 (save state)
+// and Shift+F1-F4 (load state), returns the length of the sequence or 0.
+func terminalStateSlot(bs []byte) (slot int, load bool, n int) {
+	const keys = "PQRS"
+
+	switch {
+	case bytes.HasPrefix(bs, []byte("\x1bO")) && len(bs) >= 3:
+		if i := bytes.IndexByte([]byte(keys), bs[2]); i >= 0 {
+			return i + 1, false, 3
+		}
+
+	case bytes.HasPrefix(bs, []byte("\x1b[1;2")) && len(bs) >= 6:
+		if i := bytes.IndexByte([]byte(keys), bs[5]); i >= 0 {
+			return i + 1, true, 6
+		}
+	}
+
+	return 0, false, 0
+}
+
+// Draw only keeps the screen, it's written to the terminal once per frame
+// to keep the amount of output reasonable over slow connections.
+func (hal *Terminal) Draw(fb vm.Framebuffer) error {
+	if fb.Width == hal.framebuffer.Width && fb.Height == hal.framebuffer.Height {
+		if bytes.Equal(fb.Pixels, hal.framebuffer.Pixels) {
+			return nil
+		}
+	} else {
+		// Resolution has changed, clear the leftovers of the previous one
+		if _, err := hal.out.WriteString(ansiClear); err != nil {
+			return fmt.Errorf("failed to write to terminal: %w", err)
+		}
+	}
+
+	hal.framebuffer.Width = fb.Width
+	hal.framebuffer.Height = fb.Height
+	hal.framebuffer.Pixels = append(hal.framebuffer.Pixels[:0], fb.Pixels...)
+	hal.dirty = true
+	return nil
+}
+
+// render writes the screen using upper half blocks: the foreground color
+// is the upper pixel and the background color is the lower one.
+func (hal *Terminal) render(colors []uint32) error {
+	fb := hal.framebuffer
+
+	hal.buffer.Reset()
+	hal.buffer.WriteString(ansiHome)
+
+	for y := 0; y < fb.Height; y += 2 {
+		fg, bg := -1, -1
+		for x := 0; x < fb.Width; x++ {
+			upper := int(colors[y*fb.Width+x])
+			lower := int(hal.options.Palette.RGB(0))
+			if y+1 < fb.Height {
+				lower = int(colors[(y+1)*fb.Width+x])
+			}
+
+			if upper != fg {
+				fmt.Fprintf(&hal.buffer, "\x1b[38;2;%d;%d;%dm", upper>>16, (upper>>8)&0xff, upper&0xff)
+				fg = upper
+			}
+
+			if lower != bg {
+				fmt.Fprintf(&hal.buffer, "\x1b[48;2;%d;%d;%dm", lower>>16, (lower>>8)&0xff, lower&0xff)
+				bg = lower
+			}
+
+			hal.buffer.WriteString(upperHalfBlock)
+		}
+
+		hal.buffer.WriteString(ansiReset + "\r\n")
+	}
+
+	if _, err := hal.out.Write(hal.buffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to write to terminal: %w", err)
+	}
+
+	return nil
+}
+
+// Sound rings the terminal bell once the buzzer starts, a terminal can't
+// play a continuous tone.
+func (hal *Terminal) Sound(on bool, _ *vm.AudioPattern) error {
+	ring := on && !hal.sounding
+	hal.sounding = on
+	if !ring {
+		return nil
+	}
+
+	if _, err := hal.out.WriteString(ansiBell); err != nil {
+		return fmt.Errorf("failed to write to terminal: %w", err)
+	}
+
+	return nil
+}
+
+func (hal *Terminal) WaitForNextFrame() error {
+	if hal.phosphor != nil && hal.framebuffer.Width > 0 {
+		// The phosphor keeps fading even if nothing is drawn
+		hal.dirty = false
+		if colors, changed := hal.phosphor.Apply(hal.framebuffer); changed {
+			if err := hal.render(colors); err != nil {
+				return err
+			}
+		}
+	} else if hal.dirty {
+		hal.dirty = false
+
+		hal.colors = hal.colors[:0]
+		for _, pixel := range hal.framebuffer.Pixels {
+			hal.colors = append(hal.colors, hal.options.Palette.RGB(pixel))
+		}
+
+		if err := hal.render(hal.colors); err != nil {
+			return err
+		}
+	}
+
+	hal.clock.wait()
+	return nil
+}
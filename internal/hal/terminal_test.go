@@ -0,0 +1,82 @@
+package hal
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+func TestTerminalInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []vm.Key
+		quit   bool
+	}{
+		{name: "keys", chunks: []string{"1x"}, want: []vm.Key{vm.Key1, vm.KeyA}},
+		{name: "arrow", chunks: []string{"\x1b[A"}, want: []vm.Key{vm.Key5}},
+		{name: "arrow split between reads", chunks: []string{"1\x1b", "[A"}, want: []vm.Key{vm.Key1, vm.Key5}},
+		{name: "arrow split after CSI", chunks: []string{"\x1b[", "A"}, want: []vm.Key{vm.Key5}},
+		{name: "SS3 arrow split between reads", chunks: []string{"\x1bO", "A"}, want: []vm.Key{vm.Key5}},
+		{name: "unknown CSI sequence", chunks: []string{"\x1b[15~1"}, want: []vm.Key{vm.Key1}},
+		{name: "unknown CSI sequence split between reads", chunks: []string{"\x1b[1", "5~1"}, want: []vm.Key{vm.Key1}},
+		{name: "unknown SS3 sequence", chunks: []string{"\x1bOx1"}, want: []vm.Key{vm.Key1}},
+		{name: "Alt with a key", chunks: []string{"\x1bq1"}, want: []vm.Key{vm.Key1}},
+		{name: "Esc", chunks: []string{"1\x1b"}, want: []vm.Key{vm.Key1}, quit: true},
+		{name: "Esc followed by Esc", chunks: []string{"\x1b\x1b[A"}, quit: true},
+		{name: "Ctrl+C", chunks: []string{"\x03"}, quit: true},
+	}
+
+	up, err := keymap.ParseTarget("5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, err := keymap.ParseTarget("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := keymap.ParseTarget("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := terminalKeys(keymap.Keymap{Keys: map[string]keymap.Target{"up": up, "1": one, "x": a}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hal := &Terminal{
+				options: Options{KeyReleaseTimeout: time.Hour},
+				input:   make(chan []byte, len(tt.chunks)),
+				keys:    keys,
+			}
+
+			var pressed []vm.Key
+			keyDown := func(key vm.Key) { pressed = append(pressed, key) }
+			keyUp := func(vm.Key) {}
+
+			var err error
+			for _, chunk := range tt.chunks {
+				hal.input <- []byte(chunk)
+				if err = hal.ReadInput(keyDown, keyUp); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				// Let a trailing Esc time out
+				time.Sleep(2 * escapeTimeout)
+				err = hal.ReadInput(keyDown, keyUp)
+			}
+
+			if quit := errors.Is(err, ErrQuit); quit != tt.quit || (err != nil && !quit) {
+				t.Errorf("err = %v, want quit: %v", err, tt.quit)
+			}
+			if !slices.Equal(pressed, tt.want) {
+				t.Errorf("pressed %v, want %v", pressed, tt.want)
+			}
+		})
+	}
+}
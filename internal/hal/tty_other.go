@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package hal
+
+import "errors"
+
+func makeRaw(_ uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
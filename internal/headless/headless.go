@@ -0,0 +1,124 @@
+package headless
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// ErrDone is returned once the requested number of frames has been run.
+var ErrDone = errors.New("all frames have been run")
+
+// KeyEvent is a scripted press or release of a key. It's delivered to the
+// VM when the input is read during the given frame, frames are counted from 0.
+type KeyEvent struct {
+	Frame int
+	Key   vm.Key
+	Down  bool
+}
+
+type Options struct {
+	Frames int        // Number of frames to run, 0 to run until the VM stops
+	Keys   []KeyEvent // Key events, in any order
+}
+
+// HAL is an in-memory HAL that runs as fast as possible: it doesn't sleep
+// between frames, keeps the last drawn framebuffer and counts beeps.
+// A beep is a run of frames during which the buzzer sounds.
+type HAL struct {
+	options     Options
+	frame       int
+	nextKey     int
+	framebuffer vm.Framebuffer
+	draws       int
+	beeps       int
+	soundFrames int
+	sounding    bool
+}
+
+func New(options Options) *HAL {
+	options.Keys = append([]KeyEvent(nil), options.Keys...)
+	sort.SliceStable(options.Keys, func(i, j int) bool {
+		return options.Keys[i].Frame < options.Keys[j].Frame
+	})
+
+	return &HAL{
+		options: options,
+		framebuffer: vm.Framebuffer{
+			Width:  vm.ScreenWidth,
+			Height: vm.ScreenHeight,
+			Pixels: make([]uint8, vm.ScreenWidth*vm.ScreenHeight),
+		},
+	}
+}
+
+func (hal *HAL) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
+	for hal.nextKey < len(hal.options.Keys) && hal.options.Keys[hal.nextKey].Frame <= hal.frame {
+		e := hal.options.Keys[hal.nextKey]
+		hal.nextKey++
+
+		if e.Down {
+			keyDown(e.Key)
+		} else {
+			keyUp(e.Key)
+		}
+	}
+
+	return nil
+}
+
+func (hal *HAL) Draw(fb vm.Framebuffer) error {
+	hal.framebuffer.Width = fb.Width
+	hal.framebuffer.Height = fb.Height
+	hal.framebuffer.Pixels = append(hal.framebuffer.Pixels[:0], fb.Pixels...)
+	hal.draws++
+	return nil
+}
+
+func (hal *HAL) Sound(on bool, _ *vm.AudioPattern) error {
+	if on {
+		if !hal.sounding {
+			hal.beeps++
+		}
+		hal.soundFrames++
+	}
+	hal.sounding = on
+	return nil
+}
+
+func (hal *HAL) WaitForNextFrame() error {
+	hal.frame++
+	if hal.options.Frames > 0 && hal.frame >= hal.options.Frames {
+		return ErrDone
+	}
+
+	return nil
+}
+
+// Frame returns the number of frames run so far.
+func (hal *HAL) Frame() int {
+	return hal.frame
+}
+
+// Framebuffer returns a copy of the last drawn screen.
+func (hal *HAL) Framebuffer() vm.Framebuffer {
+	fb := hal.framebuffer
+	fb.Pixels = append([]uint8(nil), fb.Pixels...)
+	return fb
+}
+
+// Draws returns the number of times the screen has been drawn.
+func (hal *HAL) Draws() int {
+	return hal.draws
+}
+
+// Beeps returns the number of times the VM has beeped.
+func (hal *HAL) Beeps() int {
+	return hal.beeps
+}
+
+// SoundFrames returns the number of frames during which the buzzer sounded.
+func (hal *HAL) SoundFrames() int {
+	return hal.soundFrames
+}
@@ -0,0 +1,203 @@
+package keymap
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Target is what a physical key or a gamepad button does: it either presses
+// one of the CHIP-8 keys (the target is the key itself) or triggers a hotkey.
+type Target int
+
+const (
+	Reboot Target = Target(vm.KeyCount) + iota
+	Rewind
+
+	targetCount = int(Rewind) + 1
+)
+
+// Key returns the CHIP-8 key pressed by the target.
+func (t Target) Key() (vm.Key, bool) {
+	if t < 0 || t >= Target(vm.KeyCount) {
+		return 0, false
+	}
+
+	return vm.Key(t), true
+}
+
+func (t Target) String() string {
+	switch t {
+	case Reboot:
+		return "reboot"
+	case Rewind:
+		return "rewind"
+	default:
+		return strconv.FormatInt(int64(t), 16)
+	}
+}
+
+// ParseTarget parses a hexadecimal CHIP-8 key or a name of a hotkey.
+func ParseTarget(s string) (Target, error) {
+	for t := Target(0); t < Target(targetCount); t++ {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown key %q, expected 0-f, %s or %s", s, Reboot, Rewind)
+}
+
+// Keymap maps physical keys and gamepad buttons to targets. Keys are named
+// by the characters they type, lowercase, or by names of special keys:
+// space, enter, tab, backspace, up, down, left and right. Frontends may
+// support more names. Buttons are named as by SDL GameController:
+// a, b, x, y, back, start, leftshoulder, dpup, dpleft and so on.
+type Keymap struct {
+	Keys    map[string]Target
+	Buttons map[string]Target
+}
+
+// Mapping is a part of a keymap config, every target listed in it
+// replaces all of its keys or buttons.
+type Mapping struct {
+	Preset  string              `json:"preset,omitempty"`
+	Keys    map[string][]string `json:"keys,omitempty"`
+	Buttons map[string][]string `json:"buttons,omitempty"`
+}
+
+// Config is a keymap config file. ROMs are matched by the SHA-1 hash
+// of their contents or by their file names.
+type Config struct {
+	Mapping
+	ROMs map[string]Mapping `json:"roms,omitempty"`
+}
+
+// Load reads a keymap config file.
+func Load(path string) (*Config, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err = json.Unmarshal(bs, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse keymap %q: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// Keymap returns the keymap of a ROM. The preset of the ROM is used if set,
+// then the one of the config and QWERTY otherwise. The mapping of the config
+// is applied over it, then the recommended keys and buttons (e.g. from a ROM
+// database) are added and the mapping of the ROM is applied last.
+func (c *Config) Keymap(romName string, romHash string, recommended Keymap) (Keymap, error) {
+	rom, ok := c.ROMs[romHash]
+	if !ok {
+		rom = c.ROMs[romName]
+	}
+
+	name := DefaultPreset
+	for _, preset := range []string{c.Preset, rom.Preset} {
+		if preset != "" {
+			name = preset
+		}
+	}
+
+	preset, ok := presets[name]
+	if !ok {
+		return Keymap{}, fmt.Errorf("unknown keymap preset %q", name)
+	}
+
+	keymap := Keymap{
+		Keys:    make(map[string]Target),
+		Buttons: make(map[string]Target),
+	}
+
+	for _, m := range []Mapping{preset, defaultMapping, c.Mapping} {
+		if err := keymap.apply(m); err != nil {
+			return Keymap{}, err
+		}
+	}
+
+	maps.Copy(keymap.Keys, recommended.Keys)
+	maps.Copy(keymap.Buttons, recommended.Buttons)
+
+	if err := keymap.apply(rom); err != nil {
+		return Keymap{}, err
+	}
+
+	return keymap, nil
+}
+
+func (k Keymap) apply(m Mapping) error {
+	if err := bind(k.Keys, m.Keys); err != nil {
+		return err
+	}
+
+	return bind(k.Buttons, m.Buttons)
+}
+
+// Default returns the default QWERTY keymap.
+func Default() Keymap {
+	keymap, _ := (&Config{}).Keymap("", "", Keymap{})
+	return keymap
+}
+
+// bind replaces keys or buttons of every listed target. A key or a button
+// can't be listed for two targets, as which one wins would be random.
+func bind(m map[string]Target, bindings map[string][]string) error {
+	bound := make(map[string]string) // Targets of the listed keys, as listed
+
+	for _, s := range slices.Sorted(maps.Keys(bindings)) {
+		target, err := ParseTarget(s)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range bindings[s] {
+			name = strings.ToLower(name)
+			if prev, ok := bound[name]; ok {
+				return fmt.Errorf("%q is bound to both %s and %s", name, prev, s)
+			}
+			bound[name] = s
+		}
+
+		for name, t := range m {
+			if t == target {
+				delete(m, name)
+			}
+		}
+
+		for _, name := range bindings[s] {
+			m[strings.ToLower(name)] = target
+		}
+	}
+
+	return nil
+}
+
+// PresetNames returns names of all presets.
+func PresetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IsPreset returns true if there's a preset with the given name.
+func IsPreset(name string) bool {
+	_, ok := presets[name]
+	return ok
+}
@@ -0,0 +1,27 @@
+package keymap_test
+
+import (
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/keymap"
+)
+
+func TestPresets(t *testing.T) {
+	for _, name := range keymap.PresetNames() {
+		config := keymap.Config{Mapping: keymap.Mapping{Preset: name}}
+		if _, err := config.Keymap("", "", keymap.Keymap{}); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
+
+func TestKeymapRejectsDuplicateKeys(t *testing.T) {
+	config := keymap.Config{Mapping: keymap.Mapping{
+		Keys: map[string][]string{"1": {"j"}, "2": {"J"}},
+	}}
+
+	_, err := config.Keymap("", "", keymap.Keymap{})
+	if want := `"j" is bound to both 1 and 2`; err == nil || err.Error() != want {
+		t.Errorf("Keymap() error = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,61 @@
+package keymap
+
+const DefaultPreset = "qwerty"
+
+// Presets map keys at the same positions to the CHIP-8 keypad in different layouts:
+//
+//	| 1 | 2 | 3 | 4 |       | 1 | 2 | 3 | C |
+//	| q | w | e | r |       | 4 | 5 | 6 | D |
+//	| a | s | d | f |  <=>  | 7 | 8 | 9 | E |
+//	| z | x | c | v |       | A | 0 | B | F |
+var presets = map[string]Mapping{
+	"qwerty": {Keys: grid("1234", "qwer", "asdf", "zxcv")},
+	"dvorak": {Keys: grid("1234", "',.p", "aoeu", ";qjk")},
+	"azerty": {Keys: addKeys(grid("1234", "azer", "qsdf", "wxcv"),
+		// Digits need Shift in AZERTY, so accept the characters of the keys too
+		map[string][]string{"1": {"&"}, "2": {"é"}, "3": {"\""}, "c": {"'"}}),
+	},
+}
+
+// defaultMapping is applied over every preset: hotkeys and gamepad buttons,
+// the d-pad is mapped as WASD keys of QWERTY.
+var defaultMapping = Mapping{
+	Keys: map[string][]string{
+		"reboot": {"backspace"},
+		"rewind": {"tab"},
+	},
+	Buttons: map[string][]string{
+		"5":      {"dpup"},
+		"7":      {"dpleft"},
+		"8":      {"dpdown"},
+		"9":      {"dpright"},
+		"6":      {"a"},
+		"4":      {"b"},
+		"reboot": {"back"},
+		"rewind": {"leftshoulder"},
+	},
+}
+
+// keypad is the CHIP-8 keypad, row by row.
+var keypad = [4]string{"123c", "456d", "789e", "a0bf"}
+
+// grid maps rows of keys to the keypad.
+func grid(rows ...string) map[string][]string {
+	keys := make(map[string][]string)
+	for i, row := range rows {
+		for j, c := range []rune(row) {
+			target := string(keypad[i][j])
+			keys[target] = append(keys[target], string(c))
+		}
+	}
+
+	return keys
+}
+
+func addKeys(keys map[string][]string, more map[string][]string) map[string][]string {
+	for target, names := range more {
+		keys[target] = append(keys[target], names...)
+	}
+
+	return keys
+}
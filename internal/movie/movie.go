@@ -0,0 +1,270 @@
+package movie
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Version is the version of the movie format.
+const Version = 1
+
+var (
+	// ErrReboot is returned by Player when the recorded run has been rebooted.
+	ErrReboot = errors.New("reboot")
+
+	ErrInvalidMovie     = errors.New("invalid movie")
+	ErrMovieROMMismatch = errors.New("movie has been recorded with another ROM")
+)
+
+// A movie is stored as JSON lines: a header followed by events in order of frames.
+// Frames are counted from the start or the last reboot of the VM.
+
+// Header is the configuration of the VM a movie has been recorded with.
+type Header struct {
+	Version        int       `json:"version"`
+	ROMHash        string    `json:"romHash"`
+	Platform       string    `json:"platform"`
+	Quirks         vm.Quirks `json:"quirks"`
+	CyclesPerFrame int       `json:"cyclesPerFrame"`
+	Seed           uint64    `json:"seed"`
+	FaultPolicy    string    `json:"faultPolicy,omitempty"` // FaultHalt if empty
+}
+
+type EventKind string
+
+const (
+	KeyDown EventKind = "down"
+	KeyUp   EventKind = "up"
+	Reboot  EventKind = "reboot"
+)
+
+type Event struct {
+	Frame int       `json:"frame"`
+	Kind  EventKind `json:"event"`
+	Key   vm.Key    `json:"key,omitempty"`
+}
+
+// NewHeader describes the configuration of a VM.
+func NewHeader(machine *vm.VM, config vm.Config) Header {
+	hash := machine.ROMHash()
+	return Header{
+		Version:        Version,
+		ROMHash:        hex.EncodeToString(hash[:]),
+		Platform:       config.Platform.String(),
+		Quirks:         config.Quirks,
+		CyclesPerFrame: config.CyclesPerFrame,
+		Seed:           config.Seed,
+		FaultPolicy:    config.FaultPolicy.String(),
+	}
+}
+
+// Config returns the configuration of the VM to replay a movie with.
+func (h Header) Config() (vm.Config, error) {
+	platform, err := vm.ParsePlatform(h.Platform)
+	if err != nil {
+		return vm.Config{}, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+	}
+
+	faultPolicy := vm.FaultHalt
+	if h.FaultPolicy != "" {
+		if faultPolicy, err = vm.ParseFaultPolicy(h.FaultPolicy); err != nil {
+			return vm.Config{}, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+		}
+	}
+
+	return vm.Config{
+		CyclesPerFrame: h.CyclesPerFrame,
+		Quirks:         h.Quirks,
+		Platform:       platform,
+		Seed:           h.Seed,
+		FaultPolicy:    faultPolicy,
+	}, nil
+}
+
+// Check returns an error if the movie has been recorded with another ROM.
+func (h Header) Check(machine *vm.VM) error {
+	hash := machine.ROMHash()
+	if h.ROMHash != hex.EncodeToString(hash[:]) {
+		return ErrMovieROMMismatch
+	}
+
+	return nil
+}
+
+// Read reads a whole movie.
+func Read(r io.Reader) (Header, []Event, error) {
+	scanner := bufio.NewScanner(r)
+
+	var header Header
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return Header{}, nil, err
+		}
+		return Header{}, nil, fmt.Errorf("%w: missing header", ErrInvalidMovie)
+	}
+
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return Header{}, nil, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+	}
+
+	if header.Version != Version {
+		return Header{}, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidMovie, header.Version)
+	}
+
+	var events []Event
+	for line := 2; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return Header{}, nil, fmt.Errorf("%w: line %d: %v", ErrInvalidMovie, line, err)
+		}
+
+		switch e.Kind {
+		case KeyDown, KeyUp, Reboot:
+		default:
+			return Header{}, nil, fmt.Errorf("%w: line %d: unknown event %q", ErrInvalidMovie, line, e.Kind)
+		}
+
+		if e.Key >= vm.KeyCount {
+			return Header{}, nil, fmt.Errorf("%w: line %d: invalid key %d", ErrInvalidMovie, line, e.Key)
+		}
+
+		events = append(events, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Header{}, nil, err
+	}
+
+	return header, events, nil
+}
+
+// Recorder is an Input that passes key events of another Input through
+// and writes them to a movie. Every event is flushed right away, so that
+// the movie survives a crash.
+type Recorder struct {
+	input vm.Input
+	w     io.Writer
+	frame int
+	err   error
+}
+
+// NewRecorder writes the header of a movie and starts recording.
+func NewRecorder(w io.Writer, header Header, input vm.Input) (*Recorder, error) {
+	r := &Recorder{input: input, w: w}
+	if err := r.write(header); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
+	err := r.input.ReadInput(
+		func(key vm.Key) {
+			r.record(Event{Frame: r.frame, Kind: KeyDown, Key: key})
+			keyDown(key)
+		},
+		func(key vm.Key) {
+			r.record(Event{Frame: r.frame, Kind: KeyUp, Key: key})
+			keyUp(key)
+		},
+	)
+	r.frame++
+
+	if r.err != nil {
+		return fmt.Errorf("unable to record movie: %w", r.err)
+	}
+
+	return err
+}
+
+// Reboot records a reboot of the VM, it must be called before the VM is reset.
+func (r *Recorder) Reboot() error {
+	// The frame has been counted when the input returned the reboot request
+	r.record(Event{Frame: r.frame - 1, Kind: Reboot})
+	r.frame = 0
+	return r.err
+}
+
+func (r *Recorder) record(e Event) {
+	if r.err == nil {
+		r.err = r.write(e)
+	}
+}
+
+func (r *Recorder) write(v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.w.Write(append(bs, '\n'))
+	return err
+}
+
+// Player is an Input that replays key events of a movie. Other input is
+// ignored until the movie ends, but its errors, e.g. a quit request, are
+// still returned. Once the movie ends, the other input takes over.
+type Player struct {
+	input  vm.Input
+	events []Event
+	next   int
+	frame  int
+}
+
+func NewPlayer(events []Event, input vm.Input) *Player {
+	return &Player{input: input, events: events}
+}
+
+func (p *Player) ReadInput(keyDown func(vm.Key), keyUp func(vm.Key)) error {
+	if p.Finished() {
+		return p.input.ReadInput(keyDown, keyUp)
+	}
+
+	if err := p.input.ReadInput(func(vm.Key) {}, func(vm.Key) {}); err != nil {
+		return err
+	}
+
+	for ; p.next < len(p.events) && p.events[p.next].Frame <= p.frame; p.next++ {
+		e := p.events[p.next]
+		switch e.Kind {
+		case KeyDown:
+			keyDown(e.Key)
+		case KeyUp:
+			keyUp(e.Key)
+		case Reboot:
+			p.next++
+			p.frame = 0
+			return ErrReboot
+		}
+	}
+	p.frame++
+
+	if p.Finished() {
+		slog.Info("movie replay finished")
+	}
+
+	return nil
+}
+
+// Finished returns true once all events have been replayed.
+func (p *Player) Finished() bool {
+	return p.next >= len(p.events)
+}
+
+// Restart replays the movie from the beginning.
+func (p *Player) Restart() {
+	p.next = 0
+	p.frame = 0
+}
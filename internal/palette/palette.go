@@ -0,0 +1,101 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Palette maps plane bitmasks of the framebuffer pixels to 0xRRGGBB colors.
+type Palette [1 << vm.PlaneCount]uint32
+
+var Default = Palette{
+	0x000000, // Background
+	0xbea700, // First plane
+	0x4f8fd6, // Second plane
+	0xf2f2f2, // Both planes
+}
+
+// Presets are the palettes selectable by name, all of them have colors
+// for both XO-CHIP planes.
+var Presets = map[string]Palette{
+	"default": Default,
+	"mono":    {0x000000, 0xffffff, 0xaaaaaa, 0x555555},
+	"green":   {0x0a1a0a, 0x33ff66, 0x1a8033, 0x99ffb3},
+	"amber":   {0x1a0f00, 0xffb000, 0x805800, 0xffd880},
+	"octo":    {0x996600, 0xffcc00, 0xff6600, 0x662200},
+	"gameboy": {0x9bbc0f, 0x0f380f, 0x8bac0f, 0x306230},
+}
+
+// PresetNames returns names of all presets.
+func PresetNames() []string {
+	var names []string
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Parse returns a preset by name, or a palette listed as comma separated
+// #RRGGBB colors: either two (background and foreground) or four (indexed
+// by plane bitmasks). Colors missing from the list are the default ones.
+func Parse(s string) (Palette, error) {
+	if p, ok := Presets[s]; ok {
+		return p, nil
+	}
+
+	colors := strings.Split(s, ",")
+	if len(colors) != 2 && len(colors) != len(Palette{}) {
+		return Palette{}, fmt.Errorf("unknown palette %q, expected one of %s or a list of 2 or 4 colors", s, strings.Join(PresetNames(), ", "))
+	}
+
+	p := Default
+	for i, c := range colors {
+		rgb, err := ParseColor(c)
+		if err != nil {
+			return Palette{}, err
+		}
+		p[i] = rgb
+	}
+
+	return p, nil
+}
+
+// ParseColor parses a #RRGGBB color.
+func ParseColor(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 24)
+	if err != nil || len(s) != len("#RRGGBB") {
+		return 0, fmt.Errorf("invalid color %q, expected #RRGGBB", s)
+	}
+
+	return uint32(rgb), nil
+}
+
+// RGB returns the color of a pixel.
+func (p *Palette) RGB(pixel uint8) uint32 {
+	return p[int(pixel)%len(p)]
+}
+
+// Color returns the color of a pixel.
+func (p *Palette) Color(pixel uint8) color.RGBA {
+	c := p.RGB(pixel)
+	return color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xff}
+}
+
+// ColorPalette returns the palette for paletted images, indices of colors
+// are the plane bitmasks.
+func (p *Palette) ColorPalette() color.Palette {
+	colors := make(color.Palette, len(p))
+	for i := range p {
+		colors[i] = p.Color(uint8(i))
+	}
+
+	return colors
+}
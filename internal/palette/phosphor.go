@@ -0,0 +1,80 @@
+package palette
+
+import (
+	"math"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Phosphor emulates the persistence of CRT phosphor to reduce flicker of
+// XOR-drawn sprites: lit pixels light up at once, while pixels turned off
+// fade to the background over several frames.
+type Phosphor struct {
+	palette *Palette
+	decay   float64 // Fraction of the difference to the background kept from one frame to the next
+
+	width, height int
+	levels        [][3]float64 // Current colors of pixels, fading ones included
+	rgb           []uint32
+}
+
+// NewPhosphor returns a filter with the given decay from 0 (no persistence)
+// to 1 (pixels never fade).
+func NewPhosphor(p *Palette, decay float64) *Phosphor {
+	return &Phosphor{
+		palette: p,
+		decay:   math.Max(0, math.Min(1, decay)),
+	}
+}
+
+// Apply advances the filter by a frame and returns 0xRRGGBB colors of the screen,
+// they are only valid until the next call. It returns false if the colors haven't
+// changed since the previous frame.
+func (ph *Phosphor) Apply(fb vm.Framebuffer) ([]uint32, bool) {
+	if fb.Width != ph.width || fb.Height != ph.height {
+		// Resolution has changed, nothing persists
+		ph.width = fb.Width
+		ph.height = fb.Height
+		ph.levels = make([][3]float64, len(fb.Pixels))
+		ph.rgb = make([]uint32, len(fb.Pixels))
+		for i, pixel := range fb.Pixels {
+			ph.levels[i] = channels(ph.palette.RGB(pixel))
+			ph.rgb[i] = ph.palette.RGB(pixel)
+		}
+
+		return ph.rgb, true
+	}
+
+	changed := false
+	for i, pixel := range fb.Pixels {
+		target := ph.palette.RGB(pixel)
+
+		var rgb uint32
+		if pixel != 0 {
+			ph.levels[i] = channels(target)
+			rgb = target
+		} else {
+			level := &ph.levels[i]
+			t := channels(target)
+			for c := range level {
+				level[c] = t[c] + (level[c]-t[c])*ph.decay
+				if math.Abs(level[c]-t[c]) < 1 {
+					level[c] = t[c]
+				}
+
+				rgb = rgb<<8 | uint32(math.Round(level[c]))
+			}
+		}
+
+		if rgb != ph.rgb[i] {
+			ph.rgb[i] = rgb
+			changed = true
+		}
+	}
+
+	return ph.rgb, changed
+}
+
+func channels(rgb uint32) [3]float64 {
+	return [3]float64{float64(rgb >> 16 & 0xff), float64(rgb >> 8 & 0xff), float64(rgb & 0xff)}
+}
@@ -0,0 +1,102 @@
+package romdb
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The database uses the format of programs.json of the CHIP-8 database,
+// https://github.com/chip-8/chip-8-database, so that its entries can be
+// copied as they are. Only the bundled ROMs are included, "make update-romdb"
+// imports their entries from the CHIP-8 database.
+//
+//go:embed programs.json
+var programsJSON []byte
+
+// Program is a game or another program, possibly with several ROMs.
+type Program struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Release     string         `json:"release,omitempty"`
+	Authors     []string       `json:"authors,omitempty"`
+	ROMs        map[string]ROM `json:"roms"` // ROMs by their SHA-1 hashes
+}
+
+// ROM is a single version of a program.
+type ROM struct {
+	File            string                     `json:"file,omitempty"`
+	EmbeddedTitle   string                     `json:"embeddedTitle,omitempty"`
+	Description     string                     `json:"description,omitempty"`
+	Platforms       []string                   `json:"platforms"` // In order of preference
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms,omitempty"`
+	Tickrate        int                        `json:"tickrate,omitempty"` // Instructions per frame
+	Colors          *Colors                    `json:"colors,omitempty"`
+	Keys            map[string]int             `json:"keys,omitempty"` // CHIP-8 keys of controls like "up" or "a"
+}
+
+type Colors struct {
+	Pixels  []string `json:"pixels,omitempty"` // #RRGGBB colors indexed by plane bitmasks
+	Buzzer  string   `json:"buzzer,omitempty"`
+	Silence string   `json:"silence,omitempty"`
+}
+
+// Entry is a ROM found in the database.
+type Entry struct {
+	Hash    string
+	Program *Program
+	ROM     *ROM
+}
+
+type Database struct {
+	entries map[string]Entry
+}
+
+// Load returns the embedded database updated with the override files,
+// which use the same format. Entries of a file replace the ones with
+// the same hashes.
+func Load(paths ...string) (*Database, error) {
+	db := &Database{entries: make(map[string]Entry)}
+	if err := db.add(programsJSON); err != nil {
+		return nil, fmt.Errorf("unable to parse embedded ROM database: %w", err)
+	}
+
+	for _, path := range paths {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = db.add(bs); err != nil {
+			return nil, fmt.Errorf("unable to parse ROM database %q: %w", path, err)
+		}
+	}
+
+	return db, nil
+}
+
+func (db *Database) add(bs []byte) error {
+	var programs []*Program
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	if err := decoder.Decode(&programs); err != nil {
+		return err
+	}
+
+	for _, program := range programs {
+		for hash, rom := range program.ROMs {
+			hash = strings.ToLower(hash)
+			db.entries[hash] = Entry{Hash: hash, Program: program, ROM: &rom}
+		}
+	}
+
+	return nil
+}
+
+// Lookup finds a ROM by its hex-encoded SHA-1 hash.
+func (db *Database) Lookup(hash string) (Entry, bool) {
+	entry, ok := db.entries[strings.ToLower(hash)]
+	return entry, ok
+}
@@ -0,0 +1,122 @@
+package romdb
+
+import (
+	"github.com/kapitanov/chip8vm/internal/keymap"
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Settings are the settings the database recommends for a ROM,
+// nil and zero values are not set.
+type Settings struct {
+	Platform       *vm.Platform
+	Quirks         *vm.Quirks
+	CyclesPerFrame int
+	Palette        *palette.Palette
+	Keymap         keymap.Keymap // Keys and buttons of the controls, to add to a keymap
+}
+
+// platforms maps platforms of the database to the emulated ones.
+var platforms = map[string]struct {
+	platform vm.Platform
+	quirks   vm.Quirks
+}{
+	"originalChip8": {vm.PlatformChip8, vm.QuirksCOSMACVIP},
+	"hybridVIP":     {vm.PlatformChip8, vm.QuirksCOSMACVIP},
+	"modernChip8":   {vm.PlatformChip8, vm.QuirksModern},
+	"chip48":        {vm.PlatformChip8, vm.QuirksCHIP48},
+	"superchip1":    {vm.PlatformSuperChip, vm.QuirksSuperChip},
+	"superchip":     {vm.PlatformSuperChip, vm.QuirksSuperChip},
+	"xochip":        {vm.PlatformXOChip, vm.QuirksXOChip},
+}
+
+// controls maps controls of the database to keys and gamepad buttons.
+var controls = map[string]struct {
+	key    string
+	button string
+}{
+	"up":    {"up", "dpup"},
+	"down":  {"down", "dpdown"},
+	"left":  {"left", "dpleft"},
+	"right": {"right", "dpright"},
+	"a":     {"", "a"},
+	"b":     {"", "b"},
+}
+
+// Settings returns the recommended settings of the entry. The first
+// platform of the ROM that can be emulated is used, with quirks of
+// the ROM applied.
+func (e Entry) Settings() (Settings, error) {
+	var s Settings
+
+	for _, name := range e.ROM.Platforms {
+		p, ok := platforms[name]
+		if !ok {
+			continue
+		}
+
+		quirks := p.quirks
+		for quirk, on := range e.ROM.QuirkyPlatforms[name] {
+			applyQuirk(&quirks, quirk, on)
+		}
+
+		s.Platform = &p.platform
+		s.Quirks = &quirks
+		break
+	}
+
+	s.CyclesPerFrame = e.ROM.Tickrate
+
+	if e.ROM.Colors != nil && len(e.ROM.Colors.Pixels) > 0 {
+		p := palette.Default
+		for i, c := range e.ROM.Colors.Pixels {
+			if i >= len(p) {
+				break
+			}
+
+			rgb, err := palette.ParseColor(c)
+			if err != nil {
+				return Settings{}, err
+			}
+			p[i] = rgb
+		}
+		s.Palette = &p
+	}
+
+	if len(e.ROM.Keys) > 0 {
+		s.Keymap = keymap.Keymap{
+			Keys:    make(map[string]keymap.Target),
+			Buttons: make(map[string]keymap.Target),
+		}
+
+		for control, key := range e.ROM.Keys {
+			c, ok := controls[control]
+			if !ok || key < 0 || key >= vm.KeyCount {
+				continue
+			}
+
+			if c.key != "" {
+				s.Keymap.Keys[c.key] = keymap.Target(key)
+			}
+			s.Keymap.Buttons[c.button] = keymap.Target(key)
+		}
+	}
+
+	return s, nil
+}
+
+// applyQuirk sets a quirk named as in the database, unsupported quirks are ignored.
+func applyQuirk(q *vm.Quirks, name string, on bool) {
+	switch name {
+	case "shift":
+		q.Shifting = on
+	case "memoryLeaveIUnchanged":
+		q.MemoryIncrement = !on
+	case "wrap":
+		q.Clipping = !on
+	case "jump":
+		q.Jumping = on
+	case "logic":
+		q.VFReset = on
+	}
+}
@@ -0,0 +1,97 @@
+// Command update imports the entries of the bundled ROMs from programs.json
+// of the CHIP-8 database, https://github.com/chip-8/chip-8-database:
+//
+//	go run ./internal/romdb/update <programs.json> <rom>... > internal/romdb/programs.json
+//
+// ROMs are matched by their SHA-1 hashes, the records are copied as they are
+// with other ROMs of the same programs left out.
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: update <programs.json> <rom>...")
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dbPath string, romPaths []string) error {
+	bs, err := os.ReadFile(dbPath)
+	if err != nil {
+		return err
+	}
+
+	// Records are kept raw, so that fields unused by the emulator survive
+	var programs []map[string]json.RawMessage
+	if err = json.Unmarshal(bs, &programs); err != nil {
+		return fmt.Errorf("unable to parse %q: %w", dbPath, err)
+	}
+
+	var hashes []string              // Hashes of the bundled ROMs, in order of the arguments
+	files := make(map[string]string) // Names of the bundled ROMs missing from the database by their hashes
+	for _, path := range romPaths {
+		rom, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		sum := sha1.Sum(rom)
+		hash := hex.EncodeToString(sum[:])
+		hashes = append(hashes, hash)
+		files[hash] = filepath.Base(path)
+	}
+
+	imported := []map[string]json.RawMessage{}
+	for _, program := range programs {
+		var roms map[string]json.RawMessage
+		if err = json.Unmarshal(program["roms"], &roms); err != nil {
+			return fmt.Errorf("unable to parse %q: %w", dbPath, err)
+		}
+
+		bundled := make(map[string]json.RawMessage)
+		for hash, rom := range roms {
+			hash = strings.ToLower(hash)
+			if _, ok := files[hash]; ok {
+				bundled[hash] = rom
+				delete(files, hash)
+			}
+		}
+
+		if len(bundled) == 0 {
+			continue
+		}
+
+		if program["roms"], err = json.Marshal(bundled); err != nil {
+			return err
+		}
+		imported = append(imported, program)
+	}
+
+	for _, hash := range hashes {
+		if name, ok := files[hash]; ok {
+			fmt.Fprintf(os.Stderr, "%s (%s) isn't in the database\n", name, hash)
+		}
+	}
+
+	out, err := json.MarshalIndent(imported, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", out)
+	return err
+}
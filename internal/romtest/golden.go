@@ -0,0 +1,148 @@
+package romtest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// gridChars are the characters of pixels in text grids, indexed by the plane bitmask.
+const gridChars = ".#+*"
+
+// colors are the colors of pixels in PNG images, indexed by the plane bitmask.
+var colors = palette.Default.ColorPalette()
+
+// ReadFramebuffer reads a screen stored as a PNG image or a text grid.
+func ReadFramebuffer(path string) (vm.Framebuffer, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return vm.Framebuffer{}, err
+	}
+
+	if isPNG(path) {
+		return decodePNG(bs)
+	}
+
+	return decodeGrid(bs)
+}
+
+// WriteFramebuffer stores a screen as a PNG image or a text grid.
+func WriteFramebuffer(path string, fb vm.Framebuffer) error {
+	var bs []byte
+	if isPNG(path) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, toImage(fb)); err != nil {
+			return err
+		}
+		bs = buf.Bytes()
+	} else {
+		bs = []byte(formatGrid(fb))
+	}
+
+	return os.WriteFile(path, bs, 0o644)
+}
+
+func isPNG(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".png")
+}
+
+func decodePNG(bs []byte) (vm.Framebuffer, error) {
+	img, err := png.Decode(bytes.NewReader(bs))
+	if err != nil {
+		return vm.Framebuffer{}, err
+	}
+
+	bounds := img.Bounds()
+	fb := vm.Framebuffer{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Pixels: make([]uint8, bounds.Dx()*bounds.Dy()),
+	}
+
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			fb.Pixels[y*fb.Width+x] = uint8(colors.Index(img.At(bounds.Min.X+x, bounds.Min.Y+y)))
+		}
+	}
+
+	return fb, nil
+}
+
+func toImage(fb vm.Framebuffer) image.Image {
+	img := image.NewPaletted(image.Rect(0, 0, fb.Width, fb.Height), colors)
+	for i, p := range fb.Pixels {
+		img.Pix[i] = p & 0x03
+	}
+
+	return img
+}
+
+func decodeGrid(bs []byte) (vm.Framebuffer, error) {
+	var fb vm.Framebuffer
+	for i, line := range strings.Split(strings.TrimSpace(string(bs)), "\n") {
+		line = strings.TrimSpace(line)
+		if fb.Width == 0 {
+			fb.Width = len(line)
+		}
+		if len(line) != fb.Width {
+			return vm.Framebuffer{}, fmt.Errorf("line %d: expected %d pixels, got %d", i+1, fb.Width, len(line))
+		}
+
+		for j := 0; j < len(line); j++ {
+			p := strings.IndexByte(gridChars, line[j])
+			if p < 0 {
+				return vm.Framebuffer{}, fmt.Errorf("line %d: unexpected character %q", i+1, line[j])
+			}
+			fb.Pixels = append(fb.Pixels, uint8(p))
+		}
+
+		fb.Height++
+	}
+
+	return fb, nil
+}
+
+func formatGrid(fb vm.Framebuffer) string {
+	var sb strings.Builder
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			sb.WriteByte(gridChars[fb.Pixels[y*fb.Width+x]&0x03])
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// diff compares two screens and describes the difference, returns an empty
+// string if they are equal.
+func diff(expected, actual vm.Framebuffer) string {
+	if expected.Width != actual.Width || expected.Height != actual.Height {
+		return fmt.Sprintf("expected %dx%d screen, got %dx%d", expected.Width, expected.Height, actual.Width, actual.Height)
+	}
+
+	count := 0
+	first := -1
+	for i := range expected.Pixels {
+		if expected.Pixels[i] != actual.Pixels[i] {
+			if first < 0 {
+				first = i
+			}
+			count++
+		}
+	}
+
+	if count == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d pixels differ, first one at (%d, %d)\nactual screen:\n%s",
+		count, first%actual.Width, first/actual.Width, formatGrid(actual))
+}
@@ -0,0 +1,81 @@
+package romtest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML report with a single test suite.
+func WriteJUnit(w io.Writer, name string, results []*Result) error {
+	suite := junitTestSuite{Name: name, Tests: len(results)}
+
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+
+		c := junitTestCase{
+			Name:      r.Test.Name,
+			ClassName: name,
+			Time:      seconds(r.Duration),
+		}
+
+		switch {
+		case r.Err != nil:
+			suite.Errors++
+			c.Error = &junitProblem{Message: r.Err.Error()}
+
+		case r.Failure != "":
+			suite.Failures++
+			c.Failure = &junitProblem{Message: "screen mismatch", Text: r.Failure}
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
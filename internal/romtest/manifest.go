@@ -0,0 +1,136 @@
+package romtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// Manifest is a list of ROM tests, stored as JSON:
+//
+//	{
+//	  "tests": [
+//	    {
+//	      "name": "test_opcode",
+//	      "rom": "test_opcode.ch8",
+//	      "quirks": "modern",
+//	      "frames": 60,
+//	      "keys": [{"frame": 10, "press": "5"}, {"frame": 12, "release": "5"}],
+//	      "expected": "test_opcode.txt"
+//	    }
+//	  ]
+//	}
+//
+// Paths are relative to the manifest file.
+type Manifest struct {
+	Tests []*Test `json:"tests"`
+}
+
+// Test runs a ROM for a number of frames and compares the final screen
+// with the expected one, stored as a PNG image or a text grid (.txt).
+type Test struct {
+	Name     string `json:"name"`
+	ROM      string `json:"rom"`
+	Platform string `json:"platform,omitempty"` // Defaults to chip8
+	Quirks   string `json:"quirks,omitempty"`   // Defaults to the quirks of the platform
+	Cycles   int    `json:"cycles,omitempty"`   // Defaults to vm.DefaultCyclesPerFrame
+	Frames   int    `json:"frames"`
+	Keys     []Key  `json:"keys,omitempty"`
+	Expected string `json:"expected"`
+}
+
+// Key is a key press or release, keys are hex digits from "0" to "f".
+type Key struct {
+	Frame   int    `json:"frame"`
+	Press   string `json:"press,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+// LoadManifest reads a manifest and resolves its paths.
+func LoadManifest(path string) (*Manifest, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err = json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("unable to parse manifest %q: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, t := range m.Tests {
+		if t.Name == "" {
+			t.Name = filepath.Base(t.ROM)
+		}
+
+		if t.ROM == "" || t.Expected == "" || t.Frames <= 0 {
+			return nil, fmt.Errorf("test #%d (%s): rom, expected and a positive number of frames are required", i+1, t.Name)
+		}
+
+		t.ROM = filepath.Join(dir, t.ROM)
+		t.Expected = filepath.Join(dir, t.Expected)
+	}
+
+	return &m, nil
+}
+
+func (t *Test) config() (vm.Config, error) {
+	platform := vm.PlatformChip8
+	if t.Platform != "" {
+		var err error
+		if platform, err = vm.ParsePlatform(t.Platform); err != nil {
+			return vm.Config{}, err
+		}
+	}
+
+	quirks := platform.DefaultQuirks()
+	if t.Quirks != "" {
+		var err error
+		if quirks, err = vm.QuirksPreset(t.Quirks); err != nil {
+			return vm.Config{}, err
+		}
+	}
+
+	cycles := t.Cycles
+	if cycles == 0 {
+		cycles = vm.DefaultCyclesPerFrame
+	}
+
+	return vm.Config{
+		CyclesPerFrame: cycles,
+		Quirks:         quirks,
+		Platform:       platform,
+	}, nil
+}
+
+func (t *Test) keyEvents() ([]headless.KeyEvent, error) {
+	var events []headless.KeyEvent
+	for _, k := range t.Keys {
+		for _, e := range []struct {
+			name string
+			down bool
+		}{
+			{k.Press, true},
+			{k.Release, false},
+		} {
+			if e.name == "" {
+				continue
+			}
+
+			key, err := strconv.ParseUint(e.name, 16, 8)
+			if err != nil || key >= vm.KeyCount {
+				return nil, fmt.Errorf("invalid key %q", e.name)
+			}
+
+			events = append(events, headless.KeyEvent{Frame: k.Frame, Key: vm.Key(key), Down: e.down})
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,71 @@
+package romtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+type Result struct {
+	Test     *Test
+	Duration time.Duration
+	Failure  string // Description of the screen mismatch, empty if the screens are equal
+	Err      error  // Error that prevented the test from running
+}
+
+func (r *Result) Passed() bool {
+	return r.Failure == "" && r.Err == nil
+}
+
+// Run runs a ROM headlessly and compares its final screen with the expected one.
+// If update is true, the expected screen is overwritten with the actual one instead.
+func Run(ctx context.Context, t *Test, update bool) *Result {
+	start := time.Now()
+	failure, err := run(ctx, t, update)
+	return &Result{
+		Test:     t,
+		Duration: time.Since(start),
+		Failure:  failure,
+		Err:      err,
+	}
+}
+
+func run(ctx context.Context, t *Test, update bool) (string, error) {
+	config, err := t.config()
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := t.keyEvents()
+	if err != nil {
+		return "", err
+	}
+
+	program, err := os.ReadFile(t.ROM)
+	if err != nil {
+		return "", fmt.Errorf("unable to load file %q: %w", t.ROM, err)
+	}
+
+	machine := vm.New(program, vm.WithConfig(config))
+	h := headless.New(headless.Options{Frames: t.Frames, Keys: keys})
+	if err = machine.Run(ctx, vm.NewHAL(h)); !errors.Is(err, headless.ErrDone) {
+		return "", fmt.Errorf("vm stopped at frame %d: %w", h.Frame(), err)
+	}
+
+	actual := machine.Framebuffer()
+	if update {
+		return "", WriteFramebuffer(t.Expected, actual)
+	}
+
+	expected, err := ReadFramebuffer(t.Expected)
+	if err != nil {
+		return "", fmt.Errorf("unable to load expected screen: %w", err)
+	}
+
+	return diff(expected, actual), nil
+}
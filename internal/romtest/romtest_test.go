@@ -0,0 +1,28 @@
+package romtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/romtest"
+)
+
+// TestROMs runs the ROM tests of the repository, like "chip8vm test roms/tests.json".
+func TestROMs(t *testing.T) {
+	m, err := romtest.LoadManifest("../../roms/tests.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range m.Tests {
+		t.Run(test.Name, func(t *testing.T) {
+			r := romtest.Run(context.Background(), test, false)
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if r.Failure != "" {
+				t.Errorf("screen mismatch:\n%s", r.Failure)
+			}
+		})
+	}
+}
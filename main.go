@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/kapitanov/chip8vm/internal/audio"
+	"github.com/kapitanov/chip8vm/internal/capture"
 	"github.com/kapitanov/chip8vm/internal/hal"
-	"github.com/kapitanov/chip8vm/internal/vm"
+	"github.com/kapitanov/chip8vm/internal/movie"
+	"github.com/kapitanov/chip8vm/internal/palette"
+	"github.com/kapitanov/chip8vm/internal/romdb"
+	"github.com/kapitanov/chip8vm/vm"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func main() {
@@ -17,12 +31,22 @@ func main() {
 		Use:           fmt.Sprintf("%s PATH_TO_ROM_FILE", filepath.Base(os.Args[0])),
 		Short:         "Run emulator",
 		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
 		SilenceErrors: true,
 	}
 
-	verbose := cmd.Flags().BoolP("verbose", "v", false, "enable verbose logging")
+	verbose := cmd.PersistentFlags().BoolP("verbose", "v", false, "enable verbose logging")
+	machineFlags := newMachineFlags(cmd.Flags())
+	frontendFlags := newFrontendFlags(cmd.Flags())
+	rewindSeconds := cmd.Flags().Int("rewind", 10, "number of seconds of gameplay kept for rewinding, 0 to disable")
+	recordPath := cmd.Flags().String("record", "", "record key presses to a movie file")
+	replayPath := cmd.Flags().String("replay", "", "replay key presses from a movie file, the VM is configured as it was recorded")
+	gifPath := cmd.Flags().String("record-gif", "", "record the screen to an animated GIF file")
+	wavPath := cmd.Flags().String("record-wav", "", "record the sound to a WAV file")
 
-	cmd.RunE = func(_ *cobra.Command, args []string) error {
+	var machine *vm.VM
+
+	cmd.PersistentPreRun = func(_ *cobra.Command, _ []string) {
 		loggerOpts := &slog.HandlerOptions{
 			Level: slog.LevelInfo,
 		}
@@ -31,39 +55,430 @@ func main() {
 		}
 
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, loggerOpts)))
+	}
 
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
 		path := args[0]
-		bs, err := os.ReadFile(path)
+		if *recordPath != "" && *replayPath != "" {
+			return errors.New("--record and --replay can't be used together")
+		}
+
+		rom, err := machineFlags.loadROM(path)
 		if err != nil {
-			return fmt.Errorf("unable to load file %q: %w", path, err)
+			return err
 		}
 
-		h, err := hal.New()
+		config, err := machineFlags.config(rom)
 		if err != nil {
-			return fmt.Errorf("unable to initialize hal: %w", err)
+			return err
+		}
+		config.RewindFrames = *rewindSeconds * vm.FrameRate
+
+		var (
+			header movie.Header
+			events []movie.Event
+		)
+		if *replayPath != "" {
+			if err = machineFlags.checkReplay(); err != nil {
+				return err
+			}
+			if header, events, err = readMovie(*replayPath); err != nil {
+				return err
+			}
+			if config, err = header.Config(); err != nil {
+				return err
+			}
+		}
+
+		options := hal.Options{
+			OnSaveState:  func(slot int) { saveState(machine, path, slot) },
+			OnLoadState:  func(slot int) { loadState(machine, path, slot) },
+			OnRewind:     func() { machine.Rewind(1) },
+			OnScreenshot: func() { saveScreenshot(machine, path, rom.palette) },
+			Palette:      rom.palette,
+		}
+
+		if *recordPath != "" || *replayPath != "" {
+			// Neither rewinding nor loading states can be reproduced by a movie
+			config.RewindFrames = 0
+			options.OnLoadState = nil
+			options.OnRewind = nil
+		}
+
+		machine = vm.New(rom.data, vm.WithConfig(config))
+
+		if *replayPath != "" {
+			if err = header.Check(machine); err != nil {
+				return err
+			}
+		}
+
+		h, err := frontendFlags.newFrontend(rom, options)
+		if err != nil {
+			return err
 		}
 		defer h.Shutdown()
 
-		machine := vm.New(bs)
+		devices := vm.NewHAL(h)
+
+		if *gifPath != "" {
+			recording := capture.NewGIF(rom.palette, capture.DefaultScale, devices.Display, devices.Clock)
+			devices.Display = recording
+			devices.Clock = recording
+			defer saveGIF(recording, *gifPath)
+		}
+
+		if *wavPath != "" {
+			sound, err := frontendFlags.soundConfig()
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Create(*wavPath)
+			if err != nil {
+				return fmt.Errorf("unable to create file %q: %w", *wavPath, err)
+			}
+			defer f.Close()
+
+			recording, err := audio.NewWAV(f, sound, devices.Audio)
+			if err != nil {
+				return fmt.Errorf("unable to record wav: %w", err)
+			}
+			devices.Audio = recording
+			defer saveWAV(recording, *wavPath)
+		}
+
+		var recorder *movie.Recorder
+		if *recordPath != "" {
+			f, err := os.Create(*recordPath)
+			if err != nil {
+				return fmt.Errorf("unable to create file %q: %w", *recordPath, err)
+			}
+			defer f.Close()
+
+			if recorder, err = movie.NewRecorder(f, movie.NewHeader(machine, config), h); err != nil {
+				return fmt.Errorf("unable to record movie: %w", err)
+			}
+			devices.Input = recorder
+		}
+
+		var player *movie.Player
+		if *replayPath != "" {
+			player = movie.NewPlayer(events, h)
+			devices.Input = player
+		}
 
 		for {
-			err = machine.Run(h)
+			err = machine.Run(cmd.Context(), devices)
 
-			if errors.Is(err, hal.ErrQuit) {
+			if errors.Is(err, hal.ErrQuit) || errors.Is(err, context.Canceled) {
 				return nil
 			}
 
-			if errors.Is(err, hal.ErrReboot) {
-				continue
+			if !errors.Is(err, hal.ErrReboot) && !errors.Is(err, movie.ErrReboot) {
+				// The program has crashed, the frontend may let the user reset it
+				crash := newCrashError(machine, err)
+				screen, ok := h.(crashScreen)
+				if !ok || !errors.Is(screen.ShowCrash(crash.lines()), hal.ErrReboot) {
+					return crash
+				}
+				err = hal.ErrReboot
+			}
+
+			if recorder != nil {
+				if rerr := recorder.Reboot(); rerr != nil {
+					return fmt.Errorf("unable to record movie: %w", rerr)
+				}
 			}
 
-			return nil
+			if player != nil && errors.Is(err, hal.ErrReboot) {
+				// Rebooted by the user, replay the movie once again
+				player.Restart()
+			}
 		}
 	}
 
+	cmd.AddCommand(newDebugCommand())
+	cmd.AddCommand(newDisasmCommand())
+	cmd.AddCommand(newAsmCommand())
+	cmd.AddCommand(newTestCommand())
+	cmd.AddCommand(newCaptureCommand())
+	cmd.AddCommand(newInfoCommand())
+	cmd.AddCommand(newBenchCommand())
+
+	// Interrupting stops the VM, so that recordings are saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cmd.SetArgs(os.Args[1:])
-	if err := cmd.Execute(); err != nil {
-		slog.Error("fatal error", "err", err)
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+
+		var crash *crashError
+		if errors.As(err, &crash) {
+			fmt.Fprintln(os.Stderr, strings.Join(crash.report, "\n"))
+		}
+
 		os.Exit(1)
 	}
 }
+
+// machineFlags are the command line flags shared by all commands that run a VM.
+type machineFlags struct {
+	flags    *pflag.FlagSet
+	platform *string
+	quirks   *string
+	cycles   *int
+	seed     *uint64
+	palette  *string
+	romDB    *string
+	faults   *string
+}
+
+func newMachineFlags(flags *pflag.FlagSet) *machineFlags {
+	return &machineFlags{
+		flags:    flags,
+		platform: flags.StringP("platform", "p", vm.PlatformChip8.String(), fmt.Sprintf("emulated platform (%s), defaults to the one recommended by the ROM database", strings.Join(vm.PlatformNames(), ", "))),
+		quirks:   flags.StringP("quirks", "q", "", fmt.Sprintf("quirks preset (%s), defaults to the one recommended by the ROM database or of the platform", strings.Join(vm.QuirksPresetNames(), ", "))),
+		cycles:   flags.IntP("cycles", "c", vm.DefaultCyclesPerFrame, "number of instructions executed per frame (60 frames per second), defaults to the one recommended by the ROM database"),
+		seed:     flags.Uint64("seed", 0, "seed of the random number generator, random unless specified"),
+		palette:  flags.String("palette", "", fmt.Sprintf("palette (%s) or comma separated #RRGGBB colors, defaults to the one recommended by the ROM database", strings.Join(palette.PresetNames(), ", "))),
+		romDB:    flags.String("rom-db", "", fmt.Sprintf("ROM database file overriding the embedded one, defaults to %s if it exists", configFilePath("roms.json"))),
+		faults:   flags.String("faults", vm.FaultHalt.String(), fmt.Sprintf("what to do when the program faults (%s, %s, %s)", vm.FaultHalt, vm.FaultWrap, vm.FaultIgnore)),
+	}
+}
+
+// checkReplay returns an error if flags configuring the VM are set along with
+// --replay, as the VM is configured as the movie was recorded.
+func (f *machineFlags) checkReplay() error {
+	for _, name := range []string{"platform", "quirks", "cycles", "seed", "faults"} {
+		if f.flags.Changed(name) {
+			return fmt.Errorf("--%s can't be used with --replay, the movie sets it", name)
+		}
+	}
+
+	return nil
+}
+
+// romFile is a loaded ROM file along with its settings from the ROM database.
+type romFile struct {
+	path     string
+	data     []byte
+	hash     string
+	entry    *romdb.Entry // nil if the ROM isn't in the database
+	settings romdb.Settings
+	palette  *palette.Palette // Palette set by the flags or recommended by the database
+}
+
+// loadROM reads a ROM file and looks it up in the ROM database.
+func (f *machineFlags) loadROM(path string) (*romFile, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load file %q: %w", path, err)
+	}
+
+	db, err := f.database()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum(bs)
+	rom := &romFile{path: path, data: bs, hash: hex.EncodeToString(hash[:])}
+
+	if entry, ok := db.Lookup(rom.hash); ok {
+		if rom.settings, err = entry.Settings(); err != nil {
+			return nil, fmt.Errorf("invalid ROM database entry of %s: %w", rom.hash, err)
+		}
+		rom.entry = &entry
+		slog.Debug("rom found in database", "title", entry.Program.Title, "hash", rom.hash)
+	}
+
+	switch {
+	case *f.palette != "":
+		p, err := palette.Parse(*f.palette)
+		if err != nil {
+			return nil, err
+		}
+		rom.palette = &p
+
+	case rom.settings.Palette != nil:
+		rom.palette = rom.settings.Palette
+
+	default:
+		rom.palette = &palette.Default
+	}
+
+	return rom, nil
+}
+
+// database loads the ROM database with the override file set by the flags.
+func (f *machineFlags) database() (*romdb.Database, error) {
+	if *f.romDB != "" {
+		return romdb.Load(*f.romDB)
+	}
+
+	path := configFilePath("roms.json")
+	if _, err := os.Stat(path); path == "" || err != nil {
+		return romdb.Load()
+	}
+
+	return romdb.Load(path)
+}
+
+// config returns the configuration of a VM to run a ROM. The flags take
+// precedence over the settings recommended by the ROM database.
+func (f *machineFlags) config(rom *romFile) (vm.Config, error) {
+	recommended := rom.settings
+
+	platform, err := vm.ParsePlatform(*f.platform)
+	if err != nil {
+		return vm.Config{}, err
+	}
+	if recommended.Platform != nil && !f.flags.Changed("platform") {
+		platform = *recommended.Platform
+	}
+
+	quirks := platform.DefaultQuirks()
+	switch {
+	case *f.quirks != "":
+		quirks, err = vm.QuirksPreset(*f.quirks)
+		if err != nil {
+			return vm.Config{}, err
+		}
+
+	case recommended.Quirks != nil && (recommended.Platform == nil || *recommended.Platform == platform):
+		quirks = *recommended.Quirks
+	}
+
+	cycles := *f.cycles
+	if recommended.CyclesPerFrame > 0 && !f.flags.Changed("cycles") {
+		cycles = recommended.CyclesPerFrame
+	}
+
+	seed := *f.seed
+	if !f.flags.Changed("seed") {
+		seed = rand.Uint64()
+	}
+
+	faultPolicy, err := vm.ParseFaultPolicy(*f.faults)
+	if err != nil {
+		return vm.Config{}, err
+	}
+
+	return vm.Config{
+		CyclesPerFrame: cycles,
+		Quirks:         quirks,
+		Platform:       platform,
+		Seed:           seed,
+		FaultPolicy:    faultPolicy,
+	}, nil
+}
+
+// configFilePath returns the path of a file in the user's config directory.
+func configFilePath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "chip8vm", name)
+}
+
+func stateFilePath(romPath string, slot int) string {
+	return fmt.Sprintf("%s.state%d", romPath, slot)
+}
+
+func saveState(machine *vm.VM, romPath string, slot int) {
+	path := stateFilePath(romPath, slot)
+
+	f, err := os.Create(path)
+	if err != nil {
+		slog.Error("unable to save state", "slot", slot, "err", err)
+		return
+	}
+	defer f.Close()
+
+	if err = machine.SaveState(f); err != nil {
+		slog.Error("unable to save state", "slot", slot, "err", err)
+		return
+	}
+
+	slog.Info("state saved", "slot", slot, "path", path)
+}
+
+func loadState(machine *vm.VM, romPath string, slot int) {
+	path := stateFilePath(romPath, slot)
+
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("unable to load state", "slot", slot, "err", err)
+		return
+	}
+	defer f.Close()
+
+	if err = machine.LoadState(f); err != nil {
+		slog.Error("unable to load state", "slot", slot, "err", err)
+		return
+	}
+
+	slog.Info("state loaded", "slot", slot, "path", path)
+}
+
+func saveScreenshot(machine *vm.VM, romPath string, p *palette.Palette) {
+	path := fmt.Sprintf("%s.%s.png", romPath, time.Now().Format("20060102-150405"))
+
+	f, err := os.Create(path)
+	if err != nil {
+		slog.Error("unable to save screenshot", "err", err)
+		return
+	}
+	defer f.Close()
+
+	if err = capture.WritePNG(f, machine.Framebuffer(), p, capture.DefaultScale); err != nil {
+		slog.Error("unable to save screenshot", "err", err)
+		return
+	}
+
+	slog.Info("screenshot saved", "path", path)
+}
+
+func saveGIF(recording *capture.GIF, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		slog.Error("unable to save gif", "err", err)
+		return
+	}
+	defer f.Close()
+
+	if err = recording.Encode(f); err != nil {
+		slog.Error("unable to save gif", "err", err)
+		return
+	}
+
+	slog.Info("gif saved", "path", path, "frames", recording.Frames())
+}
+
+func saveWAV(recording *audio.WAV, path string) {
+	if err := recording.Close(); err != nil {
+		slog.Error("unable to save wav", "err", err)
+		return
+	}
+
+	slog.Info("wav saved", "path", path)
+}
+
+func readMovie(path string) (movie.Header, []movie.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return movie.Header{}, nil, fmt.Errorf("unable to load file %q: %w", path, err)
+	}
+	defer f.Close()
+
+	header, events, err := movie.Read(f)
+	if err != nil {
+		return movie.Header{}, nil, fmt.Errorf("unable to load movie %q: %w", path, err)
+	}
+
+	slog.Info("replaying movie", "path", path, "events", len(events), "seed", header.Seed)
+	return header, events, nil
+}
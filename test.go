@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kapitanov/chip8vm/internal/romtest"
+	"github.com/spf13/cobra"
+)
+
+func newTestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test PATH_TO_MANIFEST",
+		Short: "Run ROM regression tests",
+		Long: "Run ROM regression tests.\n" +
+			"Each ROM listed in the manifest is run headlessly for a number of frames " +
+			"and its final screen is compared with the expected one.",
+		Args: cobra.ExactArgs(1),
+	}
+
+	junit := cmd.Flags().String("junit", "", "write a JUnit XML report to a file")
+	update := cmd.Flags().Bool("update", false, "overwrite expected screens with the actual ones")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		manifest, err := romtest.LoadManifest(args[0])
+		if err != nil {
+			return err
+		}
+
+		var results []*romtest.Result
+		failed := 0
+		for _, t := range manifest.Tests {
+			r := romtest.Run(cmd.Context(), t, *update)
+			results = append(results, r)
+
+			switch {
+			case r.Err != nil:
+				failed++
+				fmt.Printf("ERROR %s: %v\n", t.Name, r.Err)
+			case r.Failure != "":
+				failed++
+				fmt.Printf("FAIL  %s: %s\n", t.Name, r.Failure)
+			default:
+				fmt.Printf("OK    %s (%.3fs)\n", t.Name, r.Duration.Seconds())
+			}
+		}
+
+		if *junit != "" {
+			f, err := os.Create(*junit)
+			if err != nil {
+				return fmt.Errorf("unable to create file %q: %w", *junit, err)
+			}
+			defer f.Close()
+
+			if err = romtest.WriteJUnit(f, "chip8vm", results); err != nil {
+				return fmt.Errorf("unable to write report: %w", err)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d tests failed", failed, len(results))
+		}
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,100 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+const benchCyclesPerFrame = 1000
+
+// benchPrograms are loops exercising groups of instructions, none of them
+// ever stops by itself.
+var benchPrograms = []struct {
+	name     string
+	platform vm.Platform
+	program  []byte
+}{
+	{
+		name: "alu",
+		program: []byte{
+			0x60, 0x01, // 200: mov v0, 1
+			0x61, 0x03, // 202: mov v1, 3
+			0x80, 0x14, // 204: add v0, v1
+			0x81, 0x05, // 206: sub v1, v0
+			0x82, 0x06, // 208: shr v2
+			0x83, 0x0E, // 20a: shl v3
+			0x84, 0x12, // 20c: and v4, v1
+			0x30, 0x00, // 20e: skeq v0, 0
+			0x70, 0x01, // 210: add v0, 1
+			0x12, 0x04, // 212: jmp 204
+		},
+	},
+	{
+		name: "sprite",
+		program: []byte{
+			0xA0, 0x50, // 200: mvi 050
+			0x80, 0x14, // 202: add v0, v1
+			0x71, 0x03, // 204: add v1, 3
+			0xD0, 0x15, // 206: sprite v0, v1, 5
+			0x12, 0x02, // 208: jmp 202
+		},
+	},
+	{
+		name:     "scroll",
+		platform: vm.PlatformXOChip,
+		program: []byte{
+			0x00, 0xFF, // 200: high
+			0xF3, 0x01, // 202: plane 3
+			0xA0, 0x50, // 204: mvi 050
+			0xD0, 0x10, // 206: xsprite v0, v1
+			0x00, 0xC3, // 208: scdown 3
+			0x00, 0xFB, // 20a: scright
+			0x00, 0xD2, // 20c: scup 2
+			0x00, 0xFC, // 20e: scleft
+			0x12, 0x06, // 210: jmp 206
+		},
+	},
+	{
+		name:     "save-load",
+		platform: vm.PlatformXOChip,
+		program: []byte{
+			0xA3, 0x00, // 200: mvi 300
+			0x50, 0xF2, // 202: save v0, vf
+			0x5F, 0x03, // 204: load vf, v0
+			0x70, 0x01, // 206: add v0, 1
+			0x12, 0x02, // 208: jmp 202
+		},
+	},
+}
+
+func BenchmarkRun(b *testing.B) {
+	for _, p := range benchPrograms {
+		b.Run(p.name, func(b *testing.B) {
+			benchmarkRun(b, p.program, vm.WithPlatform(p.platform))
+		})
+	}
+}
+
+// benchmarkRun runs the program for b.N frames and reports the number of
+// instructions executed per second.
+func benchmarkRun(b *testing.B, program []byte, opts ...vm.Option) {
+	opts = append(opts, vm.WithCyclesPerFrame(benchCyclesPerFrame), vm.WithSeed(1))
+	machine := vm.New(program, opts...)
+	h := headless.New(headless.Options{Frames: b.N})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	if err := machine.Run(context.Background(), vm.NewHAL(h)); !errors.Is(err, headless.ErrDone) {
+		b.Fatalf("vm stopped at frame %d: %v", h.Frame(), err)
+	}
+	if machine.Snapshot().Halted {
+		b.Fatal("program stopped")
+	}
+
+	b.ReportMetric(float64(b.N*benchCyclesPerFrame)/b.Elapsed().Seconds(), "instructions/s")
+}
@@ -0,0 +1,64 @@
+package vm
+
+// Pause stops executing instructions, Run keeps polling input and waiting
+// for frames so that the HAL stays responsive.
+func (vm *VM) Pause() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	vm.paused = true
+}
+
+// Resume continues executing instructions after Pause.
+func (vm *VM) Resume() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	vm.paused = false
+	vm.pendingFrames = 0
+}
+
+// Paused returns true if the VM has been paused.
+func (vm *VM) Paused() bool {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	return vm.paused
+}
+
+// StepFrame makes a paused VM run one more frame, it does nothing
+// unless the VM is paused.
+func (vm *VM) StepFrame() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if vm.paused {
+		vm.pendingFrames++
+	}
+}
+
+// nextFrame returns true if the next frame must be executed.
+func (vm *VM) nextFrame() bool {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	switch {
+	case vm.halted:
+		return false
+	case !vm.paused:
+		return true
+	case vm.pendingFrames > 0:
+		vm.pendingFrames--
+		return true
+	default:
+		return false
+	}
+}
+
+// halt keeps the program stopped until the VM is reset.
+func (vm *VM) halt() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	vm.halted = true
+}
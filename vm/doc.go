@@ -0,0 +1,24 @@
+// Package vm is an embeddable CHIP-8 interpreter supporting SUPER-CHIP 1.1
+// and XO-CHIP programs.
+//
+// A VM is created from a ROM with options and run with a HAL, the devices
+// it draws the screen, plays the sound, reads keys and waits for frames with.
+// Any of the devices may be nil, a VM without a Clock runs as fast as possible:
+//
+//	machine := vm.New(rom, vm.WithQuirks(vm.QuirksCOSMACVIP), vm.WithSeed(42))
+//	err := machine.Run(ctx, vm.HAL{Display: display, Input: input, Clock: clock})
+//
+// Run returns when ctx is done, a device returns an error or the program
+// faults (see Fault). While it runs, the VM can be paused, stepped and reset
+// from other goroutines, Snapshot returns a copy of its state.
+//
+// # Compatibility
+//
+// The package follows semantic versioning of the github.com/kapitanov/chip8vm
+// module. Within a major version, exported identifiers are neither removed
+// nor changed in incompatible ways, new ones may be added by minor versions.
+// Programs behave the same with the same options and seed, unless a patch
+// version fixes an instruction emulated incorrectly. Save states carry
+// a format version, the ones of unsupported versions are rejected with
+// ErrInvalidState. Log messages aren't a part of the API.
+package vm
@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FaultKind is the kind of a runtime fault.
+type FaultKind uint8
+
+const (
+	StackOverflow = FaultKind(iota)
+	StackUnderflow
+	MemoryOutOfBounds
+	UnknownOpcode
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case StackOverflow:
+		return "stack overflow"
+	case StackUnderflow:
+		return "stack underflow"
+	case MemoryOutOfBounds:
+		return "memory out of bounds"
+	case UnknownOpcode:
+		return "unknown opcode"
+	default:
+		return fmt.Sprintf("FaultKind(%d)", uint8(k))
+	}
+}
+
+// Fault is an error returned when the program does something the machine
+// can't do, e.g. returns from a subroutine with an empty stack.
+type Fault struct {
+	PC      uint16 // Address of the faulting instruction
+	Opcode  uint16
+	Kind    FaultKind
+	Address int // First address out of memory, for MemoryOutOfBounds only
+}
+
+func (f *Fault) Error() string {
+	if f.Kind == MemoryOutOfBounds {
+		return fmt.Sprintf("%s at 0x%04x (opcode 0x%04x): address 0x%04x", f.Kind, f.PC, f.Opcode, f.Address)
+	}
+
+	return fmt.Sprintf("%s at 0x%04x (opcode 0x%04x)", f.Kind, f.PC, f.Opcode)
+}
+
+// FaultPolicy selects what the VM does on a fault.
+type FaultPolicy uint8
+
+const (
+	// FaultHalt stops the program, Run returns the Fault.
+	FaultHalt = FaultPolicy(iota)
+
+	// FaultWrap wraps memory addresses and the stack pointer around,
+	// unknown opcodes are skipped.
+	FaultWrap
+
+	// FaultIgnore skips unknown opcodes and calls and returns overflowing
+	// or underflowing the stack. Instructions accessing memory out of
+	// bounds still run: memory out of bounds reads as zeros and writes to
+	// it are dropped.
+	FaultIgnore
+)
+
+func (p FaultPolicy) String() string {
+	switch p {
+	case FaultHalt:
+		return "halt"
+	case FaultWrap:
+		return "wrap"
+	case FaultIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("FaultPolicy(%d)", uint8(p))
+	}
+}
+
+// ParseFaultPolicy returns the fault policy with the given name.
+func ParseFaultPolicy(name string) (FaultPolicy, error) {
+	for _, p := range []FaultPolicy{FaultHalt, FaultWrap, FaultIgnore} {
+		if strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown fault policy %q, expected one of: %s, %s, %s", name, FaultHalt, FaultWrap, FaultIgnore)
+}
+
+// checkMemory returns a fault if size bytes starting at addr don't fit
+// into memory and the policy is to halt.
+func (vm *VM) checkMemory(addr, size int) error {
+	if addr+size <= len(vm.memory) || vm.faultPolicy != FaultHalt {
+		return nil
+	}
+
+	return &Fault{PC: vm.pc, Kind: MemoryOutOfBounds, Address: max(addr, len(vm.memory))}
+}
+
+// readMemory reads a byte at an address that may be out of memory.
+func (vm *VM) readMemory(addr int) uint8 {
+	if addr < len(vm.memory) {
+		return vm.memory[addr]
+	}
+
+	if vm.faultPolicy == FaultWrap {
+		return vm.memory[addr%len(vm.memory)]
+	}
+
+	return 0
+}
+
+// writeMemory writes a byte at an address that may be out of memory.
+func (vm *VM) writeMemory(addr int, value uint8) {
+	if addr < len(vm.memory) {
+		vm.memory[addr] = value
+		return
+	}
+
+	if vm.faultPolicy == FaultWrap {
+		vm.memory[addr%len(vm.memory)] = value
+	}
+}
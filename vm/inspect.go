@@ -0,0 +1,113 @@
+package vm
+
+// Snapshot is a copy of the VM state.
+type Snapshot struct {
+	PC          uint16
+	Index       uint16
+	SP          uint16
+	Registers   [RegisterCount]uint8
+	Stack       []uint16 // Occupied part of the stack, bottom first
+	DelayTimer  uint8
+	SoundTimer  uint8
+	Memory      []uint8
+	Framebuffer Framebuffer
+	Paused      bool
+	Halted      bool // Indicates the program has stopped by itself
+}
+
+// Snapshot returns a copy of the VM state, unlike other accessors it's safe
+// to call while the VM runs on another goroutine. It must not be called
+// by the Display or the Audio device, the VM is locked while drawing.
+func (vm *VM) Snapshot() Snapshot {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	return Snapshot{
+		PC:          vm.pc,
+		Index:       vm.index,
+		SP:          vm.sp,
+		Registers:   vm.Registers(),
+		Stack:       vm.Stack(),
+		DelayTimer:  vm.delayTimer,
+		SoundTimer:  vm.soundTimer,
+		Memory:      vm.Memory(),
+		Framebuffer: vm.Framebuffer(),
+		Paused:      vm.paused,
+		Halted:      vm.halted,
+	}
+}
+
+// PC returns the program counter.
+func (vm *VM) PC() uint16 {
+	return vm.pc
+}
+
+// Index returns the index register I.
+func (vm *VM) Index() uint16 {
+	return vm.index
+}
+
+// SP returns the stack pointer.
+func (vm *VM) SP() uint16 {
+	return vm.sp
+}
+
+// Registers returns a copy of V registers.
+func (vm *VM) Registers() [RegisterCount]uint8 {
+	var registers [RegisterCount]uint8
+	copy(registers[:], vm.registers)
+	return registers
+}
+
+// Stack returns a copy of the occupied part of the stack, bottom first.
+func (vm *VM) Stack() []uint16 {
+	return append([]uint16(nil), vm.stack[:vm.sp]...)
+}
+
+// DelayTimer returns the value of the delay timer.
+func (vm *VM) DelayTimer() uint8 {
+	return vm.delayTimer
+}
+
+// SoundTimer returns the value of the sound timer.
+func (vm *VM) SoundTimer() uint8 {
+	return vm.soundTimer
+}
+
+// Seed returns the seed of the random number generator.
+func (vm *VM) Seed() uint64 {
+	return vm.seed
+}
+
+// Memory returns a copy of the whole memory.
+func (vm *VM) Memory() []uint8 {
+	return append([]uint8(nil), vm.memory...)
+}
+
+// Opcode returns the instruction located at addr.
+func (vm *VM) Opcode(addr uint16) uint16 {
+	if int(addr)+1 >= len(vm.memory) {
+		return 0
+	}
+
+	return uint16(vm.memory[addr])<<8 | uint16(vm.memory[addr+1])
+}
+
+// Framebuffer returns a copy of the screen.
+func (vm *VM) Framebuffer() Framebuffer {
+	fb := vm.framebuffer()
+	fb.Pixels = append([]uint8(nil), fb.Pixels...)
+	return fb
+}
+
+// IsKnownOpcode returns true if the opcode is a valid instruction on any
+// platform, XO-CHIP instructions included.
+func IsKnownOpcode(opcode uint16) bool {
+	return xochipOpcodes[opcode].instr != &unknownInstruction
+}
+
+// Disassemble returns the mnemonic of the opcode, XO-CHIP instructions
+// included.
+func Disassemble(opcode uint16) string {
+	return xochipOpcodes[opcode].instr.Name(opcode)
+}
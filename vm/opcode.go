@@ -0,0 +1,1370 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	ErrInfiniteLoop = errors.New("infinite loop")
+	ErrExit         = errors.New("exit")
+)
+
+func (vm *VM) executeOpcode(opcode uint16) error {
+	op := &vm.opcodes[opcode]
+
+	if vm.trace {
+		slog.Debug(
+			"exec",
+			"pc", fmt.Sprintf("0x%04x", vm.pc),
+			"opcode", fmt.Sprintf("0x%04x", opcode),
+			"instr", op.instr.Name(opcode),
+		)
+	}
+
+	pc := vm.pc
+	err := op.instr.Execute(vm, op)
+	if err == nil {
+		return nil
+	}
+
+	var fault *Fault
+	if errors.As(err, &fault) {
+		fault.PC = pc
+		fault.Opcode = opcode
+	}
+
+	return err
+}
+
+type instruction struct {
+	Name    func(opcode uint16) string
+	Execute func(vm *VM, op *decodedOpcode) error
+}
+
+// decodedOpcode is an instruction along with the operands of its opcode,
+// not every instruction uses all of them.
+type decodedOpcode struct {
+	instr *instruction
+	x     uint8  // Register in the second nibble
+	y     uint8  // Register in the third nibble
+	n     uint8  // Last nibble
+	nn    uint8  // Last byte
+	nnn   uint16 // Address in the last 12 bits
+}
+
+// decodeTable holds every opcode decoded in advance, so that instructions
+// don't have to be decoded as they are executed.
+type decodeTable [0x10000]decodedOpcode
+
+// chip8Opcodes, superChipOpcodes and xochipOpcodes are the opcodes decoded
+// for each platform, instructions of the extensions a platform lacks are
+// unknown opcodes.
+var chip8Opcodes, superChipOpcodes, xochipOpcodes decodeTable
+
+func init() {
+	chip8Opcodes.fill(PlatformChip8)
+	superChipOpcodes.fill(PlatformSuperChip)
+	xochipOpcodes.fill(PlatformXOChip)
+}
+
+func (t *decodeTable) fill(platform Platform) {
+	for i := range t {
+		opcode := uint16(i)
+		t[i] = decodedOpcode{
+			instr: decode(opcode, platform),
+			x:     uint8(opcode >> 8 & 0x0F),
+			y:     uint8(opcode >> 4 & 0x0F),
+			n:     uint8(opcode & 0x000F),
+			nn:    uint8(opcode & 0x00FF),
+			nnn:   opcode & 0x0FFF,
+		}
+	}
+}
+
+func decode(opcode uint16, platform Platform) *instruction {
+	xochip := platform == PlatformXOChip
+	superChip := platform == PlatformSuperChip || xochip
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		if superChip && opcode&0x00F0 == 0x00C0 {
+			// 00CN - Scrolls the screen down by N pixels (SUPER-CHIP)
+			return &scdownInstruction
+		}
+
+		if xochip && opcode&0x00F0 == 0x00D0 {
+			// 00DN - Scrolls the screen up by N pixels (XO-CHIP)
+			return &scupInstruction
+		}
+
+		switch opcode & 0x00FF {
+		case 0x00E0:
+			// 00E0 - Clear screen
+			return &clsInstruction
+
+		case 0x00EE:
+			// 00EE - Return from subroutine
+			return &rtsInstruction
+
+		case 0x00FB:
+			// 00FB - Scrolls the screen right by 4 pixels (SUPER-CHIP)
+			if superChip {
+				return &scrightInstruction
+			}
+
+		case 0x00FC:
+			// 00FC - Scrolls the screen left by 4 pixels (SUPER-CHIP)
+			if superChip {
+				return &scleftInstruction
+			}
+
+		case 0x00FD:
+			// 00FD - Exits the interpreter (SUPER-CHIP)
+			if superChip {
+				return &exitInstruction
+			}
+
+		case 0x00FE:
+			// 00FE - Switches to low resolution (64x32) mode (SUPER-CHIP)
+			if superChip {
+				return &lowInstruction
+			}
+
+		case 0x00FF:
+			// 00FF - Switches to high resolution (128x64) mode (SUPER-CHIP)
+			if superChip {
+				return &highInstruction
+			}
+		}
+
+	case 0x1000:
+		// 1NNN - Jumps to address NNN
+		return &jmpInstruction
+
+	case 0x2000:
+		// 2NNN - Calls subroutine at NNN
+		return &jsrInstruction
+
+	case 0x3000:
+		// 3XNN - Skips the next instruction if VX equals NN
+		return &skeq1Instruction
+
+	case 0x4000:
+		// 4XNN - Skips the next instruction if VX does not equal NN
+		return &skne1Instruction
+
+	case 0x5000:
+		switch opcode & 0x000F {
+		case 0x0000:
+			// 5XY0 - Skips the next instruction if VX equals VY
+			return &skeq2Instruction
+
+		case 0x0002:
+			// 5XY2 - Stores VX to VY in memory starting at address I,
+			// I is not changed (XO-CHIP)
+			if xochip {
+				return &saveInstruction
+			}
+
+		case 0x0003:
+			// 5XY3 - Reads memory starting at address I into VX to VY,
+			// I is not changed (XO-CHIP)
+			if xochip {
+				return &loadInstruction
+			}
+		}
+
+	case 0x6000:
+		// 6XNN - Sets VX to NN
+		return &mov1Instruction
+
+	case 0x7000:
+		// 7XNN - Adds NN to VX
+		return &add1Instruction
+
+	case 0x8000:
+		// 8XY_
+		switch opcode & 0x000F {
+		case 0x0000:
+			// 8XY0 - Sets VX to the value of VY
+			return &mov2Instruction
+
+		case 0x0001:
+			// 8XY1 - Sets VX to (VX OR VY)
+			return &orInstruction
+
+		case 0x0002:
+			// 8XY2 - Sets VX to (VX AND VY)
+			return &andInstruction
+
+		case 0x0003:
+			// 8XY3 - Sets VX to (VX XOR VY)
+			return &xorInstruction
+
+		case 0x0004:
+			// 8XY4 - Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there isn't.
+			return &add2Instruction
+
+		case 0x0005:
+			// 8XY5 - VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
+			return &subInstruction
+
+		case 0x0006:
+			// 0x8XY6 - Shifts VX right by one. VF is set to the value of the least significant bit of VX before the shift.
+			return &shrInstruction
+
+		case 0x0007:
+			// 0x8XY7: Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
+			return &rsbInstruction
+
+		case 0x000E:
+			// 0x8XYE: Shifts VX left by one. VF is set to the value of the most significant bit of VX before the shift.
+			return &shlInstruction
+		}
+
+	case 0x9000:
+		// 9XY0 - Skips the next instruction if VX doesn't equal VY
+		return &skne2Instruction
+
+	case 0xA000:
+		// ANNN - Sets I to the address NNN
+		return &mviInstruction
+
+	case 0xB000:
+		// BNNN - Jumps to the address NNN plus V0
+		return &jmiInstruction
+
+	case 0xC000:
+		// CXNN - Sets VX to a random number, masked by NN
+		return &randInstruction
+
+	case 0xD000:
+		// DXYN: Draws a sprite at coordinate (VX, VY) that has a width of 8
+		// pixels and a height of N pixels.
+		// Each row of 8 pixels is read as bit-coded starting from memory
+		// location I;
+		// I value doesn't change after the execution of this instruction.
+		// VF is set to 1 if any screen pixels are flipped from set to unset
+		// when the sprite is drawn, and to 0 if that doesn't happen.
+		// DXY0: Draws a 16x16 sprite instead (SUPER-CHIP).
+		if opcode&0x000F != 0 {
+			return &spriteInstruction
+		}
+		if superChip {
+			return &xspriteInstruction
+		}
+
+	case 0xE000:
+		switch opcode & 0x00FF {
+		case 0x009E:
+			// EX9E - Skips the next instruction if the key stored in VX is pressed
+			return &skprInstruction
+
+		case 0x00A1:
+			// EXA1 - Skips the next instruction if the key stored in VX isn't pressed
+			return &skupInstruction
+		}
+
+	case 0xF000:
+		if xochip && opcode == 0xF000 {
+			// F000 NNNN - Sets I to the address NNNN, the instruction
+			// is 4 bytes long (XO-CHIP)
+			return &mvilInstruction
+		}
+
+		switch opcode & 0x00FF {
+		case 0x0001:
+			// FN01 - Selects the planes to draw on, N is a bitmask (XO-CHIP)
+			if xochip {
+				return &planeInstruction
+			}
+
+		case 0x0002:
+			// F002 - Loads 16 bytes starting at address I into the
+			// audio pattern buffer (XO-CHIP)
+			if xochip {
+				return &audioInstruction
+			}
+
+		case 0x0007:
+			// FX07 - Sets VX to the value of the delay timer
+			return &gdelayInstruction
+
+		case 0x000A:
+			// FX0A - A key press is awaited, and then stored in VX
+			return &keyInstruction
+
+		case 0x0015:
+			// FX15 - Sets the delay timer to VX
+			return &sdelayInstruction
+
+		case 0x0018:
+			// FX18 - Sets the sound timer to VX
+			return &ssoundInstruction
+
+		case 0x001E:
+			// FX1E - Adds VX to I
+			// VF is set to 1 when range overflow (I+VX>0xFFF), and 0
+			// when there isn't.
+			return &adiInstruction
+
+		case 0x0029:
+			// FX29 - Sets I to the location of the sprite for the
+			// character in VX. Characters 0-F (in hexadecimal) are
+			// represented by a 4x5 font
+			return &fontInstruction
+
+		case 0x0030:
+			// FX30 - Sets I to the location of the sprite for the
+			// character in VX. Characters 0-F (in hexadecimal) are
+			// represented by a 8x10 font (SUPER-CHIP)
+			if superChip {
+				return &xfontInstruction
+			}
+
+		case 0x003A:
+			// FX3A - Sets the audio pattern playback pitch to VX (XO-CHIP)
+			if xochip {
+				return &pitchInstruction
+			}
+
+		case 0x0033:
+			// FX33 - Stores the Binary-coded decimal representation of VX
+			// at the addresses I, I plus 1, and I plus 2
+			return &bcdInstruction
+
+		case 0x0055:
+			// FX55 - Stores V0 to VX in memory starting at address I
+			return &strInstruction
+
+		case 0x0065:
+			// FX65 - Reads memory starting at address I into V0...VX
+			return &ldrInstruction
+
+		case 0x0075:
+			// FX75 - Stores V0 to VX in RPL user flags, X < 8 (SUPER-CHIP)
+			if superChip {
+				return &strfInstruction
+			}
+
+		case 0x0085:
+			// FX85 - Reads V0 to VX from RPL user flags, X < 8 (SUPER-CHIP)
+			if superChip {
+				return &ldrfInstruction
+			}
+		}
+	}
+
+	return &unknownInstruction
+}
+
+var (
+	// 00E0	cls	Clear the screen
+	clsInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "cls"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.clearScreen(vm.planes)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00cn	scdown n	Scroll the screen down n pixels
+	scdownInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("scdown %d", opcode&0x000F)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.scroll(0, int(op.n))
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00dn	scup n	Scroll the screen up n pixels
+	scupInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("scup %d", opcode&0x000F)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.scroll(0, -int(op.n))
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00fb	scright	Scroll the screen right 4 pixels
+	scrightInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "scright"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.scroll(4, 0)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00fc	scleft	Scroll the screen left 4 pixels
+	scleftInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "scleft"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.scroll(-4, 0)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00fd	exit	Exit the interpreter
+	exitInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "exit"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			return ErrExit
+		},
+	}
+
+	// 00fe	low	Switch to low resolution (64x32) mode
+	lowInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "low"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.setResolution(false)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00ff	high	Switch to high resolution (128x64) mode
+	highInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "high"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.setResolution(true)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 00EE	rts	return from subroutine call
+	rtsInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "rts"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			if vm.sp == 0 {
+				switch vm.faultPolicy {
+				case FaultHalt:
+					return &Fault{Kind: StackUnderflow}
+				case FaultWrap:
+					vm.sp = StackSize
+				default:
+					vm.pc += InstructionSize
+					return nil
+				}
+			}
+
+			vm.sp--
+			vm.pc = vm.stack[vm.sp]
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 1xxx	jmp xxx	jump to address xxx
+	jmpInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("jmp 0x%04x", opcode&0x0FFF)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			pc := op.nnn
+			if pc == vm.pc {
+				return ErrInfiniteLoop
+			}
+			vm.pc = pc
+			return nil
+		},
+	}
+
+	// 2xxx	jsr xxx	jump to subroutine at address xxx
+	jsrInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("jsr 0x%04x", opcode&0x0FFF)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			if int(vm.sp) >= StackSize {
+				switch vm.faultPolicy {
+				case FaultHalt:
+					return &Fault{Kind: StackOverflow}
+				case FaultWrap:
+					vm.sp = 0
+				default:
+					vm.pc += InstructionSize
+					return nil
+				}
+			}
+
+			vm.stack[vm.sp] = vm.pc
+			vm.sp++
+			vm.pc = op.nnn
+			return nil
+		},
+	}
+
+	// 3rxx	skeq vr,xx	skip if register r = constant
+	skeq1Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			y := uint8(opcode & 0x00FF)
+
+			return fmt.Sprintf("skeq v%x, %d", vX, y)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+
+			if x == op.nn {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// 4rxx	skne vr,xx	skip if register r <> constant
+	skne1Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			y := uint8(opcode & 0x00FF)
+
+			return fmt.Sprintf("skne v%x, %d", vX, y)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+
+			if x != op.nn {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// 5ry0	skeq vr,vy	skip f register r = register y
+	skeq2Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("skeq v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			if x == y {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// 5xy2	save vx,vy	store registers vx-vy at location I onwards	I is not changed
+	saveInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("save v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n, step := registerRange(op.x, op.y)
+			if err := vm.checkMemory(int(vm.index), n); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, n, true)
+
+			r := op.x
+			for i := 0; i < n; i++ {
+				vm.writeMemory(int(vm.index)+i, vm.registers[r])
+				r += step
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 5xy3	load vx,vy	load registers vx-vy from location I onwards	I is not changed
+	loadInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("load v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n, step := registerRange(op.x, op.y)
+			if err := vm.checkMemory(int(vm.index), n); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, n, false)
+
+			r := op.x
+			for i := 0; i < n; i++ {
+				vm.registers[r] = vm.readMemory(int(vm.index) + i)
+				r += step
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// mov vr,xx	move constant to register r
+	mov1Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			y := uint8(opcode & 0x00FF)
+
+			return fmt.Sprintf("mov v%x, %d", vX, y)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.registers[op.x] = op.nn
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 7rxx	add vr,vx	add constant to register r	No carry generated
+	add1Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			y := uint8(opcode & 0x00FF)
+
+			return fmt.Sprintf("add v%x, %d", vX, y)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.registers[op.x] += op.nn
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry0	mov vr,vy	move register vy into vr
+	mov2Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("mov v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = y
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry1	or rx,ry	or register vy into register vx
+	orInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("or v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = x | y
+			if vm.quirks.VFReset {
+				vm.registers[0x0F] = 0
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry2	and rx,ry	and register vy into register vx
+	andInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("and v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = x & y
+			if vm.quirks.VFReset {
+				vm.registers[0x0F] = 0
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry3	xor rx,ry	exclusive or register ry into register rx
+	xorInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("xor v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = x ^ y
+			if vm.quirks.VFReset {
+				vm.registers[0x0F] = 0
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry4	add vr,vy	add register vy to vr,carry in vf
+	add2Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("add v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			sum := uint16(x) + uint16(y)
+
+			vm.registers[op.x] = uint8(sum)
+			if sum > 0xFF {
+				vm.registers[0x0F] = 1
+			} else {
+				vm.registers[0x0F] = 0
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry5	sub vr,vy	subtract register vy from vr,borrow in vf	vf set to 1 if borrows
+	subInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("sub v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = x - y
+			if y > x {
+				vm.registers[0x0F] = 0
+			} else {
+				vm.registers[0x0F] = 1
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry6	shr vr	shift register vy right, bit 0 goes into register vf
+	// Unless the shifting quirk is enabled, vy is shifted and stored into vr.
+	shrInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+			if vY != 0 {
+				return fmt.Sprintf("shr v%x, v%x", vX, vY)
+			}
+
+			return fmt.Sprintf("shr v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			if !vm.quirks.Shifting {
+				x = vm.registers[op.y]
+			}
+
+			vm.registers[op.x] = x >> 1
+			vm.registers[0x0F] = x & 0x1
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// 8ry7	rsb vr,vy	subtract register vr from register vy, result in vr	vf set to 1 if borrows
+	rsbInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("rsb v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			vm.registers[op.x] = y - x
+			if x > y {
+				vm.registers[0x0F] = 0
+			} else {
+				vm.registers[0x0F] = 1
+			}
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// 8rye	shl vr	shift register vr left,bit 7 goes into register vf
+	// Unless the shifting quirk is enabled, vy is shifted and stored into vr.
+	shlInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+			if vY != 0 {
+				return fmt.Sprintf("shl v%x, v%x", vX, vY)
+			}
+
+			return fmt.Sprintf("shl v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			if !vm.quirks.Shifting {
+				x = vm.registers[op.y]
+			}
+
+			vm.registers[op.x] = x << 1
+			vm.registers[0x0F] = x >> 7
+
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// 8r0e	shl vr	shift register vr left,bit 7 goes into register vf
+	skne2Instruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+
+			return fmt.Sprintf("skne v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+			y := vm.registers[op.y]
+
+			if x != y {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// axxx	mvi xxx	Load index register with constant xxx
+	mviInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("mvi 0x%04x", opcode&0x0FFF)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.index = op.nnn
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// bxxx	jmi xxx	Jump to address xxx+register v0
+	// With the jumping quirk enabled, bnxx jumps to address nxx+register vn.
+	jmiInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("jmi 0x%04x", opcode&0x0FFF)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vN := uint8(0)
+			if vm.quirks.Jumping {
+				vN = op.x
+			}
+
+			vm.pc = op.nnn + uint16(vm.registers[vN])
+			return nil
+		},
+	}
+
+	// crxx	rand vr,xxx   	vr = random number less than or equal to xxx
+	randInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			mask := uint8(opcode & 0x00FF)
+			return fmt.Sprintf("rand v%x, %d", vX, mask)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			mask := uint16(op.nn)
+			x := uint16(vm.rng.Uint64())
+			x = x % (0xFF + 1)
+			x = x & mask
+
+			vm.registers[op.x] = uint8(x)
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// sprite rx,ry,s	Draw sprite at screen location rx,ry height s
+	// Sprites stored in memory at location in index register, maximum 8 bits wide.
+	// Wraps around the screen, unless the clipping quirk is enabled.
+	// If when drawn, clears a pixel, vf is set to 1 otherwise it is zero.
+	// All drawing is xor drawing (e.g. it toggles the screen pixels)
+	spriteInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+			height := opcode & 0x000F
+			return fmt.Sprintf("sprite v%x, v%x, %d", vX, vY, height)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			height := uint16(op.n)
+
+			xLocation, yLocation := uint16(vm.registers[op.x]), uint16(vm.registers[op.y])
+
+			collision, err := vm.drawSprite(xLocation, yLocation, 8, height)
+			if err != nil {
+				return err
+			}
+
+			vm.registers[0x0F] = collision
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// drxy0	xsprite rx,ry	Draw 16x16 sprite at screen location rx,ry
+	// Sprite is stored in memory at location in index register as 16 rows of 2 bytes.
+	xspriteInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			vY := (opcode & 0x00F0) >> 4
+			return fmt.Sprintf("xsprite v%x, v%x", vX, vY)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			xLocation, yLocation := uint16(vm.registers[op.x]), uint16(vm.registers[op.y])
+
+			collision, err := vm.drawSprite(xLocation, yLocation, 16, 16)
+			if err != nil {
+				return err
+			}
+
+			vm.registers[0x0F] = collision
+			vm.pc += InstructionSize
+
+			return nil
+		},
+	}
+
+	// ek9e	skpr k	skip if key (register rk) pressed	The key is a key number, see the chip-8 documentation
+	skprInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("skpr v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x] & 0x0F // Keys are 0-F, the rest of VX is ignored
+
+			if vm.keypad[x] != 0 {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// eka1	skup k	skip if key (register rk) not pressed
+	skupInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("skup v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x] & 0x0F // Keys are 0-F, the rest of VX is ignored
+
+			if vm.keypad[x] == 0 {
+				vm.skip()
+			} else {
+				vm.pc += InstructionSize
+			}
+
+			return nil
+		},
+	}
+
+	// f000 xxxx	mvil xxxx	Load index register with 16-bit constant xxxx
+	mvilInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "mvil"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			if err := vm.checkMemory(int(vm.pc)+InstructionSize, InstructionSize); err != nil {
+				return err
+			}
+
+			hi := vm.readMemory(int(vm.pc) + 2)
+			lo := vm.readMemory(int(vm.pc) + 3)
+
+			vm.index = uint16(hi)<<8 | uint16(lo)
+			vm.pc += 2 * InstructionSize
+
+			return nil
+		},
+	}
+
+	// fn01	plane n	select the planes to draw on	n is a bitmask, 1 and 2 are planes, 3 is both
+	planeInstruction = instruction{
+		Name: func(opcode uint16) string {
+			n := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("plane %d", n)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.planes = uint8(op.x) & (1<<PlaneCount - 1)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// f002	audio	load 16 bytes from location I onwards into the audio pattern buffer
+	audioInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return "audio"
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			if err := vm.checkMemory(int(vm.index), AudioPatternSize); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, AudioPatternSize, false)
+
+			for i := range vm.audioPattern.Samples {
+				vm.audioPattern.Samples[i] = vm.readMemory(int(vm.index) + i)
+			}
+			vm.hasAudioPattern = true
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr07	gdelay vr	get delay timer into vr
+	gdelayInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("gdelay v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.registers[op.x] = vm.delayTimer
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr0a	key vr	wait for for keypress,put key in register vr
+	keyInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("key v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			keyPressed := false
+
+			for i := range vm.keypad {
+				if vm.keypad[i] != 0 {
+					vm.registers[op.x] = uint8(i)
+					keyPressed = true
+				}
+			}
+
+			if !keyPressed {
+				return nil
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr15	sdelay vr	set the delay timer to vr
+	sdelayInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("sdelay v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.delayTimer = vm.registers[op.x]
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr18	ssound vr	set the sound timer to vr
+	ssoundInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("ssound v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.soundTimer = vm.registers[op.x]
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr1e	adi vr	add register vr to the index register
+	adiInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("adi v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := uint16(vm.registers[op.x])
+
+			if vm.index+x > 0x0FFF {
+				vm.registers[0x0F] = 1
+			} else {
+				vm.registers[0x0F] = 0
+			}
+
+			vm.index += x
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr29	font vr	point I to the sprite for hexadecimal character in vr	Sprite is 5 bytes high
+	fontInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("font v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := uint16(vm.registers[op.x])
+			x = x * fontGlyphSize
+			vm.index = fontAddr + x
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr30	xfont vr	point I to the 8x10 sprite for hexadecimal character in vr	Sprite is 10 bytes high
+	xfontInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("xfont v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := uint16(vm.registers[op.x] & 0x0F)
+			x = x * bigFontGlyphSize
+			vm.index = bigFontAddr + x
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr3a	pitch vr	set the audio pattern playback pitch to vr
+	pitchInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("pitch v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			vm.audioPattern.Pitch = vm.registers[op.x]
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr33	bcd vr	store the bcd representation of register vr at location I,I+1,I+2	Doesn't change I
+	bcdInstruction = instruction{
+		Name: func(opcode uint16) string {
+			vX := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("bcd v%x", vX)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			x := vm.registers[op.x]
+
+			if err := vm.checkMemory(int(vm.index), 3); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, 3, true)
+
+			vm.writeMemory(int(vm.index), x/100)
+			vm.writeMemory(int(vm.index)+1, (x/10)%10)
+			vm.writeMemory(int(vm.index)+2, x%10)
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr55	str v0-vr	store registers v0-vr at location I onwards	I is incremented to point to the next location on. e.g. I = I + r + 1
+	strInstruction = instruction{
+		Name: func(opcode uint16) string {
+			n := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("str %d", n)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n := uint16(op.x)
+
+			if err := vm.checkMemory(int(vm.index), int(n)+1); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, int(n)+1, true)
+
+			for i := uint16(0); i <= n; i++ {
+				vm.writeMemory(int(vm.index)+int(i), vm.registers[i])
+			}
+
+			// On the original interpreter, when the operation is done, I = I + X + 1.
+			if vm.quirks.MemoryIncrement {
+				vm.index += n + 1
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fx65	ldr v0-vr	load registers v0-vr from location I onwards.
+	ldrInstruction = instruction{
+		Name: func(opcode uint16) string {
+			n := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("ldr %d", n)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n := uint16(op.x)
+
+			if err := vm.checkMemory(int(vm.index), int(n)+1); err != nil {
+				return err
+			}
+			vm.watchMemory(vm.index, int(n)+1, false)
+
+			for i := uint16(0); i <= n; i++ {
+				vm.registers[i] = vm.readMemory(int(vm.index) + int(i))
+			}
+
+			// On the original interpreter, when the operation is done, I = I + X + 1.
+			if vm.quirks.MemoryIncrement {
+				vm.index += n + 1
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr75	strf v0-vr	store registers v0-vr in RPL user flags	r must be less than 8
+	strfInstruction = instruction{
+		Name: func(opcode uint16) string {
+			n := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("strf %d", n)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n := min(op.x, RPLFlagCount-1)
+
+			copy(vm.rplFlags, vm.registers[:n+1])
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	// fr85	ldrf v0-vr	load registers v0-vr from RPL user flags	r must be less than 8
+	ldrfInstruction = instruction{
+		Name: func(opcode uint16) string {
+			n := (opcode & 0x0F00) >> 8
+			return fmt.Sprintf("ldrf %d", n)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			n := min(op.x, RPLFlagCount-1)
+
+			copy(vm.registers, vm.rplFlags[:n+1])
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+
+	unknownInstruction = instruction{
+		Name: func(opcode uint16) string {
+			return fmt.Sprintf("unknown 0x%04X", opcode)
+		},
+		Execute: func(vm *VM, op *decodedOpcode) error {
+			if vm.faultPolicy == FaultHalt {
+				return &Fault{Kind: UnknownOpcode}
+			}
+
+			vm.pc += InstructionSize
+			return nil
+		},
+	}
+)
+
+// skip skips the next instruction, taking into account that F000 NNNN
+// is twice as long as the other ones on XO-CHIP.
+func (vm *VM) skip() {
+	vm.pc += InstructionSize
+	if vm.platform == PlatformXOChip && vm.fetchOpcode() == 0xF000 {
+		vm.pc += 2 * InstructionSize
+	} else {
+		vm.pc += InstructionSize
+	}
+}
+
+// registerRange returns the number of registers from x to y inclusive and
+// the step to walk them from x, which wraps around to -1 if x is greater
+// than y.
+func registerRange(x, y uint8) (int, uint8) {
+	if x > y {
+		return int(x-y) + 1, 0xFF
+	}
+
+	return int(y-x) + 1, 1
+}
@@ -0,0 +1,926 @@
+package vm_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+// dataAddr is where the data of an opcode test is loaded.
+const dataAddr = 0x300
+
+// opcodeTest runs a program until it halts by jumping to itself, which
+// runOpcodeTest appends to the opcodes, and checks the state of the VM then.
+// A test expecting a fault checks the state at the fault instead.
+type opcodeTest struct {
+	name    string
+	opts    []vm.Option
+	program []uint16
+	data    []byte // Loaded at dataAddr
+	keys    []headless.KeyEvent
+	fault   *vm.Fault
+	want    []check
+}
+
+type result struct {
+	machine *vm.VM
+	pattern *vm.AudioPattern // Last audio pattern played
+}
+
+type check func(t *testing.T, r result)
+
+var (
+	schip     = vm.WithPlatform(vm.PlatformSuperChip)
+	xochip    = vm.WithPlatform(vm.PlatformXOChip)
+	vip       = vm.WithQuirks(vm.QuirksCOSMACVIP)
+	superChip = vm.WithQuirks(vm.QuirksSuperChip)
+
+	// font0 is the glyph of 0 of the 4x5 font.
+	font0 = []string{
+		"####",
+		"#..#",
+		"#..#",
+		"#..#",
+		"####",
+	}
+)
+
+var opcodeTests = []opcodeTest{
+	{
+		name:    "00E0 cls",
+		program: []uint16{0xA000, 0xD005, 0x00E0},
+		want:    []check{screen(0, 0)},
+	},
+	{
+		name:    "00E0 cls clears the selected planes only",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0xA000, 0xD005, 0xF201, 0xD005, 0xF101, 0x00E0},
+		want:    []check{screen(0, 0, planes(font0, '+')...)},
+	},
+	{
+		name:    "00CN scdown",
+		opts:    []vm.Option{schip},
+		program: []uint16{0xA000, 0xD005, 0x00C2},
+		want:    []check{screen(0, 2, font0...)},
+	},
+	{
+		name:    "00CN scdown on CHIP-8",
+		program: []uint16{0x00C2},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00C2, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00DN scup",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x6104, 0xA000, 0xD015, 0x00D3},
+		want:    []check{screen(0, 1, font0...)},
+	},
+	{
+		name:    "00DN scup on CHIP-8",
+		program: []uint16{0x00D3},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00D3, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00FB scright",
+		opts:    []vm.Option{schip},
+		program: []uint16{0xA000, 0xD005, 0x00FB},
+		want:    []check{screen(4, 0, font0...)},
+	},
+	{
+		name:    "00FB scright on CHIP-8",
+		program: []uint16{0x00FB},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00FB, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00FC scleft",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6008, 0xA000, 0xD015, 0x00FC},
+		want:    []check{screen(4, 0, font0...)},
+	},
+	{
+		name:    "00FC scleft on CHIP-8",
+		program: []uint16{0x00FC},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00FC, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00FC scleft drops pixels scrolled out",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6002, 0xA000, 0xD015, 0x00FC},
+		want:    []check{screen(0, 0, "##", ".#", ".#", ".#", "##")},
+	},
+	{
+		name:    "00FD exit",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6001, 0x00FD, 0x6002},
+		want:    []check{regs(0, 1), pc(0x202)},
+	},
+	{
+		name:    "00FD exit on CHIP-8",
+		program: []uint16{0x00FD},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00FD, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00FE low",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x00FF, 0x00FE},
+		want:    []check{resolution(vm.ScreenWidth, vm.ScreenHeight)},
+	},
+	{
+		name:    "00FE low on CHIP-8",
+		program: []uint16{0x00FE},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00FE, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "00FF high",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x00FF},
+		want:    []check{resolution(vm.HiResScreenWidth, vm.HiResScreenHeight)},
+	},
+	{
+		name:    "00FF high on CHIP-8",
+		program: []uint16{0x00FF},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00FF, Kind: vm.UnknownOpcode},
+	},
+	{
+		name: "00EE rts",
+		program: []uint16{
+			0x2206, // 200: jsr 206
+			0x6101, // 202: mov v1, 1
+			0x1204, // 204: jmp 204
+			0x6002, // 206: mov v0, 2
+			0x00EE, // 208: rts
+		},
+		want: []check{regs(0, 2, 1, 1), pc(0x204), stack()},
+	},
+	{
+		name:    "00EE rts with an empty stack",
+		program: []uint16{0x00EE},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x00EE, Kind: vm.StackUnderflow},
+	},
+	{
+		name:    "1NNN jmp",
+		program: []uint16{0x1204, 0x6001, 0x6102},
+		want:    []check{regs(0, 0, 1, 2)},
+	},
+	{
+		name:    "2NNN jsr",
+		program: []uint16{0x2202},
+		want:    []check{pc(0x202), stack(0x200)},
+	},
+	{
+		name:    "2NNN jsr with a full stack",
+		program: []uint16{0x2200},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x2200, Kind: vm.StackOverflow},
+	},
+	{
+		name:    "3XNN skeq equal",
+		program: []uint16{0x6005, 0x3005, 0x6101},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "3XNN skeq not equal",
+		program: []uint16{0x6005, 0x3006, 0x6101},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "3XNN skeq skips F000 NNNN",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x3000, 0xF000, 0x0123, 0x6101},
+		want:    []check{regs(1, 1), index(0)},
+	},
+	{
+		name:    "3XNN skeq skips F000 as a 2 byte opcode on CHIP-8",
+		program: []uint16{0x3000, 0xF000, 0x6101},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "4XNN skne equal",
+		program: []uint16{0x6005, 0x4005, 0x6101},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "4XNN skne not equal",
+		program: []uint16{0x6005, 0x4006, 0x6101},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "5XY0 skeq equal",
+		program: []uint16{0x6005, 0x6205, 0x5020, 0x6101},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "5XY0 skeq not equal",
+		program: []uint16{0x6005, 0x6206, 0x5020, 0x6101},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "5XY2 save",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x6111, 0x6222, 0x6333, 0xA300, 0x5132},
+		want:    []check{memory(0x300, 0x11, 0x22, 0x33, 0x00), index(0x300)},
+	},
+	{
+		name:    "5XY2 save in descending order",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x6111, 0x6222, 0x6333, 0xA300, 0x5312},
+		want:    []check{memory(0x300, 0x33, 0x22, 0x11, 0x00)},
+	},
+	{
+		name:    "5XY2 save on CHIP-8",
+		program: []uint16{0x5132},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x5132, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "5XY3 load",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0xA300, 0x5133},
+		data:    []byte{0x11, 0x22, 0x33},
+		want:    []check{regs(0, 0, 1, 0x11, 2, 0x22, 3, 0x33), index(0x300)},
+	},
+	{
+		name:    "5XY3 load in descending order",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0xA300, 0x5313},
+		data:    []byte{0x11, 0x22, 0x33},
+		want:    []check{regs(1, 0x33, 2, 0x22, 3, 0x11)},
+	},
+	{
+		name:    "5XY3 load on CHIP-8",
+		program: []uint16{0x5133},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x5133, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "6XNN mov",
+		program: []uint16{0x6A42},
+		want:    []check{regs(0xA, 0x42)},
+	},
+	{
+		name:    "7XNN add",
+		program: []uint16{0x60FF, 0x7002},
+		want:    []check{regs(0, 1, 0xF, 0)},
+	},
+	{
+		name:    "8XY0 mov",
+		program: []uint16{0x6142, 0x8010},
+		want:    []check{regs(0, 0x42)},
+	},
+	{
+		name:    "8XY1 or",
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8011},
+		want:    []check{regs(0, 0x0E, 0xF, 1)},
+	},
+	{
+		name:    "8XY1 or resets VF",
+		opts:    []vm.Option{vip},
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8011},
+		want:    []check{regs(0, 0x0E, 0xF, 0)},
+	},
+	{
+		name:    "8XY2 and",
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8012},
+		want:    []check{regs(0, 0x08, 0xF, 1)},
+	},
+	{
+		name:    "8XY2 and resets VF",
+		opts:    []vm.Option{vip},
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8012},
+		want:    []check{regs(0, 0x08, 0xF, 0)},
+	},
+	{
+		name:    "8XY3 xor",
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8013},
+		want:    []check{regs(0, 0x06, 0xF, 1)},
+	},
+	{
+		name:    "8XY3 xor resets VF",
+		opts:    []vm.Option{vip},
+		program: []uint16{0x600C, 0x610A, 0x6F01, 0x8013},
+		want:    []check{regs(0, 0x06, 0xF, 0)},
+	},
+	{
+		name:    "8XY4 add",
+		program: []uint16{0x6010, 0x6120, 0x8014},
+		want:    []check{regs(0, 0x30, 0xF, 0)},
+	},
+	{
+		name:    "8XY4 add with a carry",
+		program: []uint16{0x60F0, 0x6120, 0x8014},
+		want:    []check{regs(0, 0x10, 0xF, 1)},
+	},
+	{
+		name:    "8XY4 add of 0x80 to itself",
+		program: []uint16{0x6080, 0x8004},
+		want:    []check{regs(0, 0, 0xF, 1)},
+	},
+	{
+		name:    "8XY4 add into VF",
+		program: []uint16{0x6FFF, 0x6103, 0x8F14},
+		want:    []check{regs(0xF, 1)},
+	},
+	{
+		name:    "8XY4 add of VF",
+		program: []uint16{0x6010, 0x6F20, 0x80F4},
+		want:    []check{regs(0, 0x30, 0xF, 0)},
+	},
+	{
+		name:    "8XY5 sub",
+		program: []uint16{0x6030, 0x6110, 0x8015},
+		want:    []check{regs(0, 0x20, 0xF, 1)},
+	},
+	{
+		name:    "8XY5 sub with a borrow",
+		program: []uint16{0x6010, 0x6130, 0x8015},
+		want:    []check{regs(0, 0xE0, 0xF, 0)},
+	},
+	{
+		name:    "8XY5 sub into VF",
+		program: []uint16{0x6F05, 0x6103, 0x8F15},
+		want:    []check{regs(0xF, 1)},
+	},
+	{
+		name:    "8XY6 shr",
+		program: []uint16{0x6005, 0x6108, 0x8016},
+		want:    []check{regs(0, 0x04, 1, 0x08, 0xF, 0)},
+	},
+	{
+		name:    "8XY6 shr in place",
+		opts:    []vm.Option{superChip},
+		program: []uint16{0x6005, 0x6108, 0x8016},
+		want:    []check{regs(0, 0x02, 0xF, 1)},
+	},
+	{
+		name:    "8XY6 shr into VF",
+		program: []uint16{0x6F05, 0x8FF6},
+		want:    []check{regs(0xF, 1)},
+	},
+	{
+		name:    "8XY7 rsb",
+		program: []uint16{0x6010, 0x6130, 0x8017},
+		want:    []check{regs(0, 0x20, 0xF, 1)},
+	},
+	{
+		name:    "8XY7 rsb with a borrow",
+		program: []uint16{0x6030, 0x6110, 0x8017},
+		want:    []check{regs(0, 0xE0, 0xF, 0)},
+	},
+	{
+		name:    "8XY7 rsb into VF",
+		program: []uint16{0x6F03, 0x6105, 0x8F17},
+		want:    []check{regs(0xF, 1)},
+	},
+	{
+		name:    "8XYE shl",
+		program: []uint16{0x6081, 0x6101, 0x801E},
+		want:    []check{regs(0, 0x02, 1, 0x01, 0xF, 0)},
+	},
+	{
+		name:    "8XYE shl in place",
+		opts:    []vm.Option{superChip},
+		program: []uint16{0x6081, 0x6101, 0x801E},
+		want:    []check{regs(0, 0x02, 0xF, 1)},
+	},
+	{
+		name:    "8XYE shl into VF",
+		program: []uint16{0x6F81, 0x8FFE},
+		want:    []check{regs(0xF, 1)},
+	},
+	{
+		name:    "9XY0 skne equal",
+		program: []uint16{0x6005, 0x6205, 0x9020, 0x6101},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "9XY0 skne not equal",
+		program: []uint16{0x6005, 0x6206, 0x9020, 0x6101},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "ANNN mvi",
+		program: []uint16{0xA123},
+		want:    []check{index(0x123)},
+	},
+	{
+		name: "BNNN jmi",
+		program: []uint16{
+			0x6202, // 200: mov v2, 2
+			0xB206, // 202: jmi 206
+			0x6001, // 204: mov v0, 1
+			0x6101, // 206: mov v1, 1
+			0x6301, // 208: mov v3, 1
+		},
+		want: []check{regs(0, 0, 1, 1, 3, 1)},
+	},
+	{
+		name: "BXNN jmi with VX",
+		opts: []vm.Option{superChip},
+		program: []uint16{
+			0x6202, // 200: mov v2, 2
+			0xB206, // 202: jmi 206
+			0x6001, // 204: mov v0, 1
+			0x6101, // 206: mov v1, 1
+			0x6301, // 208: mov v3, 1
+		},
+		want: []check{regs(0, 0, 1, 0, 3, 1)},
+	},
+	{
+		name:    "CXNN rand with a zero mask",
+		program: []uint16{0x60FF, 0xC000},
+		want:    []check{regs(0, 0)},
+	},
+	{
+		name:    "CXNN rand",
+		program: []uint16{0xC00F, 0xC10F, 0xC20F, 0xC30F},
+		want: []check{func(t *testing.T, r result) {
+			registers := r.machine.Registers()
+			for i, v := range registers[:4] {
+				if v&^0x0F != 0 {
+					t.Errorf("v%x = 0x%02x, want it masked by 0x0f", i, v)
+				}
+			}
+		}},
+	},
+	{
+		name:    "DXYN sprite",
+		program: []uint16{0x6002, 0x6103, 0xA000, 0xD015},
+		want:    []check{screen(2, 3, font0...), regs(0xF, 0)},
+	},
+	{
+		name:    "DXYN sprite with a collision",
+		program: []uint16{0xA000, 0xD005, 0xD005},
+		want:    []check{screen(0, 0), regs(0xF, 1)},
+	},
+	{
+		name:    "DXYN sprite clips",
+		program: []uint16{0x603E, 0x611E, 0xA000, 0xD015},
+		want:    []check{screen(62, 30, "##", "#.")},
+	},
+	{
+		name:    "DXYN sprite wraps around",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x603E, 0x611E, 0xA000, 0xD015},
+		want:    []check{screen(62, 30, font0...)},
+	},
+	{
+		name:    "DXYN sprite out of memory",
+		program: []uint16{0xAFFE, 0xD005},
+		fault:   &vm.Fault{PC: 0x202, Opcode: 0xD005, Kind: vm.MemoryOutOfBounds, Address: 0x1000},
+	},
+	{
+		name:    "DXY0 xsprite",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x00FF, 0xA300, 0xD000},
+		data:    bytes.Repeat([]byte{0x80, 0x01}, 16),
+		want:    []check{screen(0, 0, repeat("#..............#", 16)...)},
+	},
+	{
+		name:    "DXY0 xsprite on CHIP-8",
+		program: []uint16{0xD000},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xD000, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "EX9E skpr pressed",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6005, 0xE09E, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key5, Down: true}},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "EX9E skpr not pressed",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6005, 0xE09E, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key6, Down: true}},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "EX9E skpr of the low nibble of VX",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6015, 0xE09E, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key5, Down: true}},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "EXA1 skup pressed",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6005, 0xE0A1, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key5, Down: true}},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "EXA1 skup not pressed",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6005, 0xE0A1, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key6, Down: true}},
+		want:    []check{regs(1, 0)},
+	},
+	{
+		name:    "EXA1 skup of the low nibble of VX",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6015, 0xE0A1, 0x6101},
+		keys:    []headless.KeyEvent{{Frame: 0, Key: vm.Key5, Down: true}},
+		want:    []check{regs(1, 1)},
+	},
+	{
+		name:    "F000 NNNN mvil",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0xF000, 0x1234},
+		want:    []check{index(0x1234), pc(0x204)},
+	},
+	{
+		name:    "F000 NNNN mvil on CHIP-8",
+		program: []uint16{0xF000},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF000, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "FN01 plane",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0xF201, 0xA000, 0xD005},
+		want:    []check{screen(0, 0, planes(font0, '+')...)},
+	},
+	{
+		name:    "FN01 plane on CHIP-8",
+		program: []uint16{0xF201},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF201, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "F002 audio and FX3A pitch",
+		opts:    []vm.Option{xochip, vm.WithCyclesPerFrame(1)},
+		program: []uint16{0xA300, 0xF002, 0x6070, 0xF03A, 0x6001, 0xF018},
+		data:    []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		want: []check{audio(vm.AudioPattern{
+			Samples: [vm.AudioPatternSize]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			Pitch:   0x70,
+		})},
+	},
+	{
+		name:    "F002 audio on CHIP-8",
+		program: []uint16{0xF002},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF002, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "FX3A pitch on CHIP-8",
+		program: []uint16{0xF03A},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF03A, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "FX07 gdelay and FX15 sdelay",
+		opts:    []vm.Option{vm.WithCyclesPerFrame(1)},
+		program: []uint16{0x6009, 0xF015, 0xF107},
+		want:    []check{regs(1, 8)},
+	},
+	{
+		name:    "FX0A key",
+		program: []uint16{0xF10A, 0x6201},
+		keys:    []headless.KeyEvent{{Frame: 1, Key: vm.Key7, Down: true}},
+		want:    []check{regs(1, 7, 2, 1)},
+	},
+	{
+		name:    "FX18 ssound",
+		program: []uint16{0x6005, 0xF018},
+		want: []check{func(t *testing.T, r result) {
+			if got := r.machine.SoundTimer(); got != 5 {
+				t.Errorf("sound timer = %d, want 5", got)
+			}
+		}},
+	},
+	{
+		name:    "FX1E adi",
+		program: []uint16{0xA123, 0x6010, 0xF01E},
+		want:    []check{index(0x133), regs(0xF, 0)},
+	},
+	{
+		name:    "FX1E adi past 0x0FFF",
+		program: []uint16{0xAFFF, 0x6001, 0xF01E},
+		want:    []check{index(0x1000), regs(0xF, 1)},
+	},
+	{
+		name:    "FX29 font",
+		program: []uint16{0x600A, 0xF029},
+		want:    []check{index(0x032)},
+	},
+	{
+		name:    "FX30 xfont",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6002, 0xF030},
+		want:    []check{index(0x064)},
+	},
+	{
+		name:    "FX30 xfont on CHIP-8",
+		program: []uint16{0xF030},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF030, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "FX33 bcd",
+		program: []uint16{0x60FE, 0xA300, 0xF033},
+		want:    []check{memory(0x300, 2, 5, 4), index(0x300)},
+	},
+	{
+		name:    "FX33 bcd out of memory",
+		program: []uint16{0xAFFE, 0xF033},
+		fault:   &vm.Fault{PC: 0x202, Opcode: 0xF033, Kind: vm.MemoryOutOfBounds, Address: 0x1000},
+	},
+	{
+		name:    "FX33 bcd on XO-CHIP",
+		opts:    []vm.Option{xochip},
+		program: []uint16{0x60FE, 0xAFFE, 0xF033},
+		want:    []check{memory(0xFFE, 2, 5, 4)},
+	},
+	{
+		name:    "FX55 str",
+		program: []uint16{0x6011, 0x6122, 0x6233, 0xA300, 0xF155},
+		want:    []check{memory(0x300, 0x11, 0x22, 0x00), index(0x302)},
+	},
+	{
+		name:    "FX55 str without incrementing I",
+		opts:    []vm.Option{superChip},
+		program: []uint16{0x6011, 0x6122, 0x6233, 0xA300, 0xF155},
+		want:    []check{memory(0x300, 0x11, 0x22, 0x00), index(0x300)},
+	},
+	{
+		name:    "FX55 str with the default quirks of a config without quirks",
+		opts:    []vm.Option{vm.WithConfig(vm.Config{CyclesPerFrame: 1000})},
+		program: []uint16{0x6011, 0xA300, 0xF055},
+		want:    []check{memory(0x300, 0x11), index(0x301)},
+	},
+	{
+		name:    "FX55 str out of memory",
+		program: []uint16{0xAFFF, 0xF155},
+		fault:   &vm.Fault{PC: 0x202, Opcode: 0xF155, Kind: vm.MemoryOutOfBounds, Address: 0x1000},
+	},
+	{
+		name:    "FX55 str wrapping around memory",
+		opts:    []vm.Option{vm.WithFaultPolicy(vm.FaultWrap)},
+		program: []uint16{0x6011, 0x6122, 0xAFFF, 0xF155},
+		want:    []check{memory(0xFFF, 0x11), memory(0x000, 0x22)},
+	},
+	{
+		name:    "FX55 str dropping writes out of memory",
+		opts:    []vm.Option{vm.WithFaultPolicy(vm.FaultIgnore)},
+		program: []uint16{0x6011, 0x6122, 0xAFFF, 0xF155},
+		want:    []check{memory(0xFFF, 0x11), memory(0x000, 0xF0)},
+	},
+	{
+		name:    "FX65 ldr",
+		program: []uint16{0xA300, 0xF165},
+		data:    []byte{0x11, 0x22, 0x33},
+		want:    []check{regs(0, 0x11, 1, 0x22, 2, 0), index(0x302)},
+	},
+	{
+		name:    "FX65 ldr without incrementing I",
+		opts:    []vm.Option{superChip},
+		program: []uint16{0xA300, 0xF165},
+		data:    []byte{0x11, 0x22, 0x33},
+		want:    []check{regs(0, 0x11, 1, 0x22, 2, 0), index(0x300)},
+	},
+	{
+		name:    "FX65 ldr reading zeros out of memory",
+		opts:    []vm.Option{vm.WithFaultPolicy(vm.FaultIgnore)},
+		program: []uint16{0x6011, 0xAFFF, 0xF055, 0x6000, 0x6133, 0xAFFF, 0xF165},
+		want:    []check{regs(0, 0x11, 1, 0)},
+	},
+	{
+		name:    "FX75 strf and FX85 ldrf",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6011, 0x6122, 0xF175, 0x6000, 0x6100, 0xF185},
+		want:    []check{regs(0, 0x11, 1, 0x22)},
+	},
+	{
+		name:    "FX75 strf on CHIP-8",
+		program: []uint16{0xF175},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF175, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "FX75 strf and FX85 ldrf of 8 registers at most",
+		opts:    []vm.Option{schip},
+		program: []uint16{0x6711, 0x6822, 0xFF75, 0x6700, 0x6800, 0xFF85},
+		want:    []check{regs(7, 0x11, 8, 0)},
+	},
+	{
+		name:    "FX85 ldrf on CHIP-8",
+		program: []uint16{0xF185},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0xF185, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "unknown opcode",
+		program: []uint16{0x5001},
+		fault:   &vm.Fault{PC: 0x200, Opcode: 0x5001, Kind: vm.UnknownOpcode},
+	},
+	{
+		name:    "unknown opcode ignored",
+		opts:    []vm.Option{vm.WithFaultPolicy(vm.FaultIgnore)},
+		program: []uint16{0x5001, 0x6001},
+		want:    []check{regs(0, 1)},
+	},
+}
+
+func TestOpcodes(t *testing.T) {
+	for _, tt := range opcodeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := runOpcodeTest(tt)
+
+			var fault *vm.Fault
+			switch {
+			case tt.fault != nil:
+				if !errors.As(err, &fault) {
+					t.Fatalf("err = %v, want %v", err, tt.fault)
+				}
+				if *fault != *tt.fault {
+					t.Fatalf("fault = %+v, want %+v", *fault, *tt.fault)
+				}
+
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			for _, c := range tt.want {
+				c(t, r)
+			}
+		})
+	}
+}
+
+// runOpcodeTest steps through the program until it stops by itself or
+// faults.
+func runOpcodeTest(tt opcodeTest) (result, error) {
+	program := make([]byte, 0, 2*len(tt.program)+2)
+	for _, opcode := range tt.program {
+		program = append(program, byte(opcode>>8), byte(opcode))
+	}
+	halt := 0x1000 | (int(vm.ProgramStart) + len(program))
+	program = append(program, byte(halt>>8), byte(halt))
+
+	if tt.data != nil {
+		program = append(program, make([]byte, dataAddr-int(vm.ProgramStart)-len(program))...)
+		program = append(program, tt.data...)
+	}
+
+	opts := append([]vm.Option{vm.WithCyclesPerFrame(1000), vm.WithSeed(1)}, tt.opts...)
+	machine := vm.New(program, opts...)
+	h := headless.New(headless.Options{Frames: 10, Keys: tt.keys})
+	audio := &audioRecorder{}
+	hal := vm.HAL{Display: h, Audio: audio, Input: h, Clock: h}
+
+	machine.Reset()
+	for {
+		err := machine.Step(hal)
+		switch {
+		case errors.Is(err, vm.ErrInfiniteLoop), errors.Is(err, vm.ErrExit):
+			return result{machine: machine, pattern: audio.pattern}, nil
+
+		case errors.Is(err, headless.ErrDone):
+			return result{}, fmt.Errorf("program hasn't stopped, pc = 0x%04x", machine.PC())
+
+		case err != nil:
+			return result{machine: machine, pattern: audio.pattern}, err
+		}
+	}
+}
+
+// audioRecorder keeps the last audio pattern played.
+type audioRecorder struct {
+	pattern *vm.AudioPattern
+}
+
+func (a *audioRecorder) Sound(_ bool, pattern *vm.AudioPattern) error {
+	if pattern != nil {
+		p := *pattern
+		a.pattern = &p
+	}
+	return nil
+}
+
+// regs checks registers, given as pairs of a register number and a value.
+func regs(pairs ...uint8) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		registers := r.machine.Registers()
+		for i := 0; i < len(pairs); i += 2 {
+			if got := registers[pairs[i]]; got != pairs[i+1] {
+				t.Errorf("v%x = 0x%02x, want 0x%02x", pairs[i], got, pairs[i+1])
+			}
+		}
+	}
+}
+
+func index(want uint16) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		if got := r.machine.Index(); got != want {
+			t.Errorf("i = 0x%04x, want 0x%04x", got, want)
+		}
+	}
+}
+
+// pc checks the address of the instruction the program has stopped at.
+func pc(want uint16) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		if got := r.machine.PC(); got != want {
+			t.Errorf("pc = 0x%04x, want 0x%04x", got, want)
+		}
+	}
+}
+
+func stack(want ...uint16) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		got := r.machine.Stack()
+		if len(got) != len(want) {
+			t.Errorf("stack = %x, want %x", got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("stack = %x, want %x", got, want)
+				return
+			}
+		}
+	}
+}
+
+func memory(addr int, want ...byte) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		if got := r.machine.Memory()[addr : addr+len(want)]; !bytes.Equal(got, want) {
+			t.Errorf("memory at 0x%04x = %x, want %x", addr, got, want)
+		}
+	}
+}
+
+func resolution(width, height int) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		fb := r.machine.Framebuffer()
+		if fb.Width != width || fb.Height != height {
+			t.Errorf("resolution = %dx%d, want %dx%d", fb.Width, fb.Height, width, height)
+		}
+	}
+}
+
+func audio(want vm.AudioPattern) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		switch {
+		case r.pattern == nil:
+			t.Errorf("no audio pattern has been played")
+		case *r.pattern != want:
+			t.Errorf("audio pattern = %+v, want %+v", *r.pattern, want)
+		}
+	}
+}
+
+// gridChars are the characters of pixels lit on no plane, the first,
+// the second and both planes.
+const gridChars = ".#+*"
+
+// screen checks the pixels of the rectangle at (x, y) wrapping around the
+// edges of the screen, given row by row in gridChars, and that no other
+// pixel is lit.
+func screen(x, y int, rows ...string) check {
+	return func(t *testing.T, r result) {
+		t.Helper()
+		fb := r.machine.Framebuffer()
+
+		want := make([]uint8, len(fb.Pixels))
+		for dy, row := range rows {
+			for dx := range row {
+				want[(y+dy)%fb.Height*fb.Width+(x+dx)%fb.Width] = uint8(strings.IndexByte(gridChars, row[dx]))
+			}
+		}
+
+		if !bytes.Equal(fb.Pixels, want) {
+			t.Errorf("screen:\n%s\nwant:\n%s", render(fb.Pixels, fb.Width), render(want, fb.Width))
+		}
+	}
+}
+
+func render(pixels []uint8, width int) string {
+	var sb strings.Builder
+	for i, p := range pixels {
+		sb.WriteByte(gridChars[p&0x03])
+		if (i+1)%width == 0 {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// planes replaces the pixels lit on the first plane with c.
+func planes(rows []string, c byte) []string {
+	replaced := make([]string, len(rows))
+	for i, row := range rows {
+		replaced[i] = strings.ReplaceAll(row, "#", string(c))
+	}
+	return replaced
+}
+
+func repeat(row string, n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = row
+	}
+	return rows
+}
@@ -0,0 +1,65 @@
+package vm
+
+// Option configures a VM created by New.
+type Option func(*options)
+
+type options struct {
+	config Config
+	quirks bool // Indicates the quirks have been set, otherwise the platform ones are used
+}
+
+// WithConfig sets the whole configuration at once, options following it
+// override its fields. Zero Quirks stand for the default quirks of the
+// platform, use WithQuirks to turn all quirks off.
+func WithConfig(config Config) Option {
+	return func(o *options) {
+		o.config = config
+		o.quirks = config.Quirks != Quirks{}
+	}
+}
+
+// WithCyclesPerFrame sets the number of instructions executed per frame,
+// DefaultCyclesPerFrame by default.
+func WithCyclesPerFrame(n int) Option {
+	return func(o *options) {
+		o.config.CyclesPerFrame = n
+	}
+}
+
+// WithQuirks sets the interpretation of ambiguous instructions, the default
+// quirks of the platform by default.
+func WithQuirks(quirks Quirks) Option {
+	return func(o *options) {
+		o.config.Quirks = quirks
+		o.quirks = true
+	}
+}
+
+// WithPlatform sets the emulated machine, PlatformChip8 by default.
+func WithPlatform(platform Platform) Option {
+	return func(o *options) {
+		o.config.Platform = platform
+	}
+}
+
+// WithRewind keeps the given number of recent frames for rewinding,
+// rewinding is disabled by default.
+func WithRewind(frames int) Option {
+	return func(o *options) {
+		o.config.RewindFrames = frames
+	}
+}
+
+// WithSeed sets the seed of the random number generator, 0 by default.
+func WithSeed(seed uint64) Option {
+	return func(o *options) {
+		o.config.Seed = seed
+	}
+}
+
+// WithFaultPolicy sets what to do on a fault, FaultHalt by default.
+func WithFaultPolicy(policy FaultPolicy) Option {
+	return func(o *options) {
+		o.config.FaultPolicy = policy
+	}
+}
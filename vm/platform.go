@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Platform selects the machine the VM emulates.
+type Platform uint8
+
+const (
+	// PlatformChip8 is the original CHIP-8 machine with 4 KB of memory.
+	PlatformChip8 = Platform(iota)
+
+	// PlatformXOChip is the XO-CHIP machine extending SUPER-CHIP 1.1 with
+	// 64 KB of memory, two bitplanes and audio pattern playback.
+	PlatformXOChip
+
+	// PlatformSuperChip is the SUPER-CHIP 1.1 machine extending CHIP-8 with
+	// the 128x64 high resolution mode, scrolling, 16x16 sprites, the big
+	// font and RPL user flags.
+	PlatformSuperChip
+)
+
+// platforms lists every platform, in the order they are presented in.
+var platforms = []Platform{PlatformChip8, PlatformSuperChip, PlatformXOChip}
+
+func (p Platform) String() string {
+	switch p {
+	case PlatformChip8:
+		return "chip8"
+	case PlatformSuperChip:
+		return "schip"
+	case PlatformXOChip:
+		return "xochip"
+	default:
+		return fmt.Sprintf("Platform(%d)", uint8(p))
+	}
+}
+
+// MemorySize returns the amount of memory available on the platform.
+func (p Platform) MemorySize() int {
+	if p == PlatformXOChip {
+		return XOChipMemorySize
+	}
+
+	return MemorySize
+}
+
+// opcodes returns the opcodes decoded for the platform.
+func (p Platform) opcodes() *decodeTable {
+	switch p {
+	case PlatformSuperChip:
+		return &superChipOpcodes
+	case PlatformXOChip:
+		return &xochipOpcodes
+	default:
+		return &chip8Opcodes
+	}
+}
+
+// DefaultQuirks returns the quirks most ROMs written for the platform expect.
+func (p Platform) DefaultQuirks() Quirks {
+	switch p {
+	case PlatformSuperChip:
+		return QuirksSuperChip
+	case PlatformXOChip:
+		return QuirksXOChip
+	default:
+		return QuirksModern
+	}
+}
+
+// PlatformNames returns the names accepted by ParsePlatform.
+func PlatformNames() []string {
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		names[i] = p.String()
+	}
+	return names
+}
+
+// ParsePlatform returns the platform with the given name.
+func ParsePlatform(name string) (Platform, error) {
+	for _, p := range platforms {
+		if strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown platform %q, expected one of: %s", name, strings.Join(PlatformNames(), ", "))
+}
+
+// AudioPattern is an XO-CHIP audio pattern: 128 1-bit samples played
+// back in a loop at a rate controlled by Pitch.
+type AudioPattern struct {
+	Samples [AudioPatternSize]uint8
+	Pitch   uint8
+}
+
+// SampleRate returns the playback rate of the pattern in samples per second.
+func (p *AudioPattern) SampleRate() float64 {
+	return 4000 * math.Pow(2, (float64(p.Pitch)-64)/48)
+}
@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirks selects between the conflicting interpretations of ambiguous
+// CHIP-8 instructions that different interpreters have historically used.
+type Quirks struct {
+	// VFReset makes 8XY1, 8XY2 and 8XY3 (or, and, xor) reset VF to zero.
+	VFReset bool
+
+	// MemoryIncrement makes FX55 and FX65 (str, ldr) leave I pointing past
+	// the last register that was stored or loaded.
+	MemoryIncrement bool
+
+	// Shifting makes 8XY6 and 8XYE (shr, shl) shift VX in place instead of
+	// shifting VY and storing the result into VX.
+	Shifting bool
+
+	// Jumping makes BNNN (jmi) jump to XNN plus VX instead of NNN plus V0.
+	Jumping bool
+
+	// Clipping makes sprites drawn past the edge of the screen clip instead
+	// of wrapping around to the opposite edge.
+	Clipping bool
+}
+
+// The presets follow the platforms of the CHIP-8 database
+// (https://github.com/chip-8/chip-8-database).
+var (
+	// QuirksCOSMACVIP matches the original interpreter of the COSMAC VIP.
+	QuirksCOSMACVIP = Quirks{
+		VFReset:         true,
+		MemoryIncrement: true,
+		Shifting:        false,
+		Jumping:         false,
+		Clipping:        true,
+	}
+
+	// QuirksCHIP48 matches the CHIP-48 interpreter of the HP-48 calculators.
+	// CHIP-48 increments I by X only, which isn't emulated: I is left
+	// unchanged as on SUPER-CHIP 1.1, which fixed that.
+	QuirksCHIP48 = Quirks{
+		VFReset:         false,
+		MemoryIncrement: false,
+		Shifting:        true,
+		Jumping:         true,
+		Clipping:        true,
+	}
+
+	// QuirksSuperChip matches the SUPER-CHIP 1.1 interpreter.
+	QuirksSuperChip = Quirks{
+		VFReset:         false,
+		MemoryIncrement: false,
+		Shifting:        true,
+		Jumping:         true,
+		Clipping:        true,
+	}
+
+	// QuirksModern matches what most modern interpreters do and what most
+	// ROMs written for them expect.
+	QuirksModern = Quirks{
+		VFReset:         false,
+		MemoryIncrement: true,
+		Shifting:        false,
+		Jumping:         false,
+		Clipping:        true,
+	}
+
+	// QuirksXOChip matches the XO-CHIP specification.
+	QuirksXOChip = Quirks{
+		VFReset:         false,
+		MemoryIncrement: true,
+		Shifting:        false,
+		Jumping:         false,
+		Clipping:        false,
+	}
+
+	quirksPresets = map[string]Quirks{
+		"vip":    QuirksCOSMACVIP,
+		"chip48": QuirksCHIP48,
+		"schip":  QuirksSuperChip,
+		"modern": QuirksModern,
+		"xochip": QuirksXOChip,
+	}
+)
+
+// QuirksPresetNames returns the names accepted by QuirksPreset.
+func QuirksPresetNames() []string {
+	names := make([]string, 0, len(quirksPresets))
+	for name := range quirksPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QuirksPreset returns the quirks preset with the given name.
+func QuirksPreset(name string) (Quirks, error) {
+	quirks, ok := quirksPresets[strings.ToLower(name)]
+	if !ok {
+		return Quirks{}, fmt.Errorf("unknown quirks preset %q, expected one of: %s", name, strings.Join(QuirksPresetNames(), ", "))
+	}
+
+	return quirks, nil
+}
@@ -0,0 +1,159 @@
+package vm
+
+// rewindBuffer is a ring buffer of per-frame VM snapshots.
+// To keep snapshots compact, memory is not copied as a whole: each snapshot
+// only keeps the original values of the bytes overwritten during its frame.
+type rewindBuffer struct {
+	frames []rewindFrame
+	start  int // Index of the oldest snapshot
+	count  int // Number of snapshots in the buffer
+
+	shadow  []uint8 // Memory contents at the start of the latest frame
+	pending bool    // Indicates memory delta of the latest snapshot isn't computed yet
+}
+
+// rewindFrame is a snapshot of the VM state taken at the start of a frame.
+type rewindFrame struct {
+	registers   stateRegisters
+	vRegs       [RegisterCount]uint8
+	stack       [StackSize]uint16
+	samples     [AudioPatternSize]uint8
+	keypad      [KeyCount]uint8
+	rplFlags    [RPLFlagCount]uint8
+	rng         [rngStateSize]uint8 // Marshaled random number generator
+	gfx         []uint8
+	memoryDelta []memoryChange
+}
+
+// memoryChange is the original value of a memory byte overwritten during a frame.
+type memoryChange struct {
+	addr  uint16
+	value uint8
+}
+
+// newRewindBuffer creates a buffer for up to capacity frames,
+// returns nil if capacity is not positive.
+func newRewindBuffer(capacity, memorySize int) *rewindBuffer {
+	if capacity <= 0 {
+		return nil
+	}
+
+	return &rewindBuffer{
+		frames: make([]rewindFrame, capacity),
+		shadow: make([]uint8, memorySize),
+	}
+}
+
+// reset drops all snapshots, memory is the current contents of the VM memory.
+func (b *rewindBuffer) reset(memory []uint8) {
+	if b == nil {
+		return
+	}
+
+	b.start = 0
+	b.count = 0
+	b.pending = false
+	copy(b.shadow, memory)
+}
+
+func (b *rewindBuffer) latest() *rewindFrame {
+	return &b.frames[(b.start+b.count-1)%len(b.frames)]
+}
+
+// capture takes a snapshot of the VM state at the start of a frame.
+func (b *rewindBuffer) capture(vm *VM) {
+	if b == nil {
+		return
+	}
+
+	if b.pending {
+		b.diff(vm.memory)
+	}
+
+	if b.count == len(b.frames) {
+		// Drop the oldest snapshot
+		b.start = (b.start + 1) % len(b.frames)
+		b.count--
+	}
+	b.count++
+
+	frame := b.latest()
+	frame.registers = vm.stateRegisters()
+	copy(frame.vRegs[:], vm.registers)
+	copy(frame.stack[:], vm.stack)
+	copy(frame.samples[:], vm.audioPattern.Samples[:])
+	copy(frame.keypad[:], vm.keypad)
+	copy(frame.rplFlags[:], vm.rplFlags)
+	rng, _ := vm.rng.MarshalBinary() // Never fails for rand.PCG
+	copy(frame.rng[:], rng)
+	frame.gfx = append(frame.gfx[:0], vm.gfx...)
+	frame.memoryDelta = frame.memoryDelta[:0]
+
+	b.pending = true
+}
+
+// diff records memory bytes changed since the start of the latest frame.
+func (b *rewindBuffer) diff(memory []uint8) {
+	frame := b.latest()
+	for i := range memory {
+		if memory[i] != b.shadow[i] {
+			frame.memoryDelta = append(frame.memoryDelta, memoryChange{addr: uint16(i), value: b.shadow[i]})
+			b.shadow[i] = memory[i]
+		}
+	}
+
+	b.pending = false
+}
+
+// rewind restores the VM state up to the given number of frames back,
+// returns the number of frames actually rewound.
+func (b *rewindBuffer) rewind(vm *VM, frames int) int {
+	if b == nil {
+		return 0
+	}
+
+	if b.pending && b.count > 0 {
+		b.diff(vm.memory)
+	}
+
+	n := 0
+	for ; n < frames && b.count > 0; n++ {
+		frame := b.latest()
+
+		for _, change := range frame.memoryDelta {
+			vm.memory[change.addr] = change.value
+			b.shadow[change.addr] = change.value
+		}
+
+		vm.restoreRegisters(frame.registers)
+		copy(vm.registers, frame.vRegs[:])
+		copy(vm.stack, frame.stack[:])
+		copy(vm.audioPattern.Samples[:], frame.samples[:])
+		copy(vm.keypad, frame.keypad[:])
+		copy(vm.rplFlags, frame.rplFlags[:])
+		_ = vm.rng.UnmarshalBinary(frame.rng[:]) // Never fails for a marshaled rand.PCG
+		copy(vm.gfx, frame.gfx)
+
+		b.count--
+	}
+
+	return n
+}
+
+// Rewind steps the VM back through recently executed frames, returns the
+// number of frames actually rewound. It is limited by the length of the
+// rewind buffer (see Config.RewindFrames) and drops the frames it steps over.
+// The next frame after a rewind is only presented, not executed.
+func (vm *VM) Rewind(frames int) int {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	n := vm.rewind.rewind(vm, frames)
+	if n > 0 {
+		vm.drawFlag = true
+		vm.rewound = true
+		vm.halted = false
+	}
+
+	return n
+}
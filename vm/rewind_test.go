@@ -0,0 +1,41 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+func TestRewindRestoresRandom(t *testing.T) {
+	program := []byte{
+		0xC1, 0xFF, // 200: rand v1, ff
+		0x12, 0x00, // 202: jmp 200
+	}
+
+	hal := vm.NewHAL(headless.New(headless.Options{Frames: 10}))
+	step := func(machine *vm.VM, n int) vm.Snapshot {
+		t.Helper()
+		for range n {
+			if err := machine.Step(hal); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return machine.Snapshot()
+	}
+
+	machine := vm.New(program, vm.WithCyclesPerFrame(2), vm.WithRewind(10), vm.WithSeed(1))
+	machine.Reset()
+
+	// Run 3 frames, then rewind to the start of the second one
+	step(machine, 2)
+	want := step(machine, 2)
+	step(machine, 2)
+	if n := machine.Rewind(2); n != 2 {
+		t.Fatalf("Rewind(2) = %d, want 2", n)
+	}
+
+	if got := step(machine, 2); got.Registers != want.Registers {
+		t.Errorf("registers = %x after the rewound frame, want %x", got.Registers, want.Registers)
+	}
+}
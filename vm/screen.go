@@ -0,0 +1,137 @@
+package vm
+
+// Framebuffer is a snapshot of the screen passed to the HAL for drawing.
+// Pixels holds Width*Height bytes, one per pixel, row by row. Each byte is
+// a bitmask of the planes the pixel is lit on (bit 0 for the first plane,
+// bit 1 for the second), i.e. an index into a 4-color palette.
+type Framebuffer struct {
+	Width  int
+	Height int
+	Pixels []uint8
+}
+
+func (vm *VM) framebuffer() Framebuffer {
+	return Framebuffer{
+		Width:  vm.screenWidth,
+		Height: vm.screenHeight,
+		Pixels: vm.gfx[:vm.screenWidth*vm.screenHeight],
+	}
+}
+
+// setResolution switches between low (64x32) and high (128x64) resolution
+// modes, the screen is cleared.
+func (vm *VM) setResolution(hires bool) {
+	vm.hires = hires
+	vm.screenWidth, vm.screenHeight = ScreenWidth, ScreenHeight
+	if hires {
+		vm.screenWidth, vm.screenHeight = HiResScreenWidth, HiResScreenHeight
+	}
+
+	vm.clearScreen(0xFF)
+}
+
+// clearScreen clears the given planes.
+func (vm *VM) clearScreen(planes uint8) {
+	for i := range vm.gfx {
+		vm.gfx[i] &^= planes
+	}
+	vm.drawFlag = true
+}
+
+func (vm *VM) getScreenAddr(x, y uint16) uint16 {
+	x %= uint16(vm.screenWidth)
+	y %= uint16(vm.screenHeight)
+
+	screenAddr := uint16(vm.screenWidth)*y + x
+	return screenAddr
+}
+
+// scroll moves the contents of the selected planes by (dx, dy) pixels,
+// pixels scrolled in from outside of the screen are blank. The screen is
+// scrolled in place, walking it away from the direction of the scroll so
+// that every pixel is read before it is overwritten.
+func (vm *VM) scroll(dx, dy int) {
+	width, height := vm.screenWidth, vm.screenHeight
+
+	y0, y1, stepY := 0, height, 1
+	if dy > 0 {
+		y0, y1, stepY = height-1, -1, -1
+	}
+	x0, x1, stepX := 0, width, 1
+	if dx > 0 {
+		x0, x1, stepX = width-1, -1, -1
+	}
+
+	for y := y0; y != y1; y += stepY {
+		srcY := y - dy
+		for x := x0; x != x1; x += stepX {
+			srcX := x - dx
+
+			pixel := vm.gfx[y*width+x] &^ vm.planes
+			if srcY >= 0 && srcY < height && srcX >= 0 && srcX < width {
+				pixel |= vm.gfx[srcY*width+srcX] & vm.planes
+			}
+			vm.gfx[y*width+x] = pixel
+		}
+	}
+
+	vm.drawFlag = true
+}
+
+// drawSprite XORs a sprite located at I onto the selected planes at
+// (xLocation, yLocation). Each row of the sprite is width pixels wide and
+// occupies width/8 bytes. When both planes are selected, sprite data for the
+// second plane immediately follows the data for the first one.
+// Returns 1 if any lit pixel has been erased, 0 otherwise.
+func (vm *VM) drawSprite(xLocation, yLocation, width, height uint16) (uint8, error) {
+	screenWidth, screenHeight := uint16(vm.screenWidth), uint16(vm.screenHeight)
+	xLocation %= screenWidth
+	yLocation %= screenHeight
+
+	bytesPerRow := int(width / 8)
+	spriteAddr := int(vm.index)
+
+	hasCollision := uint8(0)
+	for plane := uint8(0); plane < PlaneCount; plane++ {
+		planeMask := uint8(1) << plane
+		if vm.planes&planeMask == 0 {
+			continue
+		}
+
+		size := int(height) * bytesPerRow
+		if err := vm.checkMemory(spriteAddr, size); err != nil {
+			return 0, err
+		}
+		vm.watchMemory(uint16(spriteAddr), size, false)
+
+		for y := uint16(0); y < height; y++ {
+			if vm.quirks.Clipping && y+yLocation >= screenHeight {
+				break
+			}
+
+			for x := uint16(0); x < width; x++ {
+				if vm.quirks.Clipping && x+xLocation >= screenWidth {
+					break
+				}
+
+				pixel := vm.readMemory(spriteAddr + int(y)*bytesPerRow + int(x/8))
+				mask := uint8(0x80 >> (x % 8))
+				if (pixel & mask) == 0 {
+					continue
+				}
+
+				screenAddr := vm.getScreenAddr(x+xLocation, y+yLocation)
+				if vm.gfx[screenAddr]&planeMask != 0 {
+					hasCollision = 1
+				}
+
+				vm.gfx[screenAddr] ^= planeMask
+			}
+		}
+
+		spriteAddr += size
+	}
+
+	vm.drawFlag = true
+	return hasCollision, nil
+}
@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	stateMagic   = "C8ST"
+	stateVersion = uint16(1)
+
+	rngStateSize = 20 // Size of a marshaled rand.PCG
+)
+
+var (
+	ErrInvalidState     = errors.New("invalid save state")
+	ErrStateROMMismatch = errors.New("save state was made for a different rom")
+)
+
+// stateHeader starts every save state file.
+type stateHeader struct {
+	Magic    [4]byte
+	Version  uint16
+	ROMHash  [sha1.Size]byte
+	Platform Platform
+}
+
+// stateRegisters holds the scalar part of the VM state.
+type stateRegisters struct {
+	SP              uint16
+	PC              uint16
+	Index           uint16
+	DelayTimer      uint8
+	SoundTimer      uint8
+	Hires           bool
+	Planes          uint8
+	HasAudioPattern bool
+	Pitch           uint8
+	Cycle           uint32
+}
+
+// state holds a complete copy of the VM state.
+type state struct {
+	registers stateRegisters
+	memory    []uint8
+	vRegs     []uint8
+	stack     []uint16
+	gfx       []uint8
+	keypad    []uint8
+	rplFlags  []uint8
+	samples   []uint8
+	rng       []uint8
+}
+
+// ROMHash returns the SHA-1 hash of the program loaded into the VM.
+func (vm *VM) ROMHash() [sha1.Size]byte {
+	return vm.romHash
+}
+
+// SaveState writes the full VM state to w.
+// The state can only be restored by a VM running the same program.
+func (vm *VM) SaveState(w io.Writer) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	header := stateHeader{
+		Version:  stateVersion,
+		ROMHash:  vm.romHash,
+		Platform: vm.platform,
+	}
+	copy(header.Magic[:], stateMagic)
+
+	s := vm.newState()
+	s.registers = vm.stateRegisters()
+	copy(s.memory, vm.memory)
+	copy(s.vRegs, vm.registers)
+	copy(s.stack, vm.stack)
+	copy(s.gfx, vm.gfx)
+	copy(s.keypad, vm.keypad)
+	copy(s.rplFlags, vm.rplFlags)
+	copy(s.samples, vm.audioPattern.Samples[:])
+
+	rng, err := vm.rng.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("unable to write save state: %w", err)
+	}
+	copy(s.rng, rng)
+
+	for _, data := range append([]any{header}, s.fields()...) {
+		if err := binary.Write(w, binary.BigEndian, data); err != nil {
+			return fmt.Errorf("unable to write save state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// LoadState restores the VM state from r.
+// The VM state is left intact if the save state cannot be loaded.
+func (vm *VM) LoadState(r io.Reader) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	var header stateHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+
+	if string(header.Magic[:]) != stateMagic {
+		return fmt.Errorf("%w: bad magic %q", ErrInvalidState, header.Magic[:])
+	}
+
+	if header.Version != stateVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidState, header.Version)
+	}
+
+	if header.ROMHash != vm.romHash {
+		return ErrStateROMMismatch
+	}
+
+	if header.Platform != vm.platform {
+		return fmt.Errorf("%w: save state was made for %s platform", ErrInvalidState, header.Platform)
+	}
+
+	s := vm.newState()
+	for _, data := range s.fields() {
+		if err := binary.Read(r, binary.BigEndian, data); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidState, err)
+		}
+	}
+
+	if s.registers.SP > StackSize {
+		return fmt.Errorf("%w: stack pointer out of range", ErrInvalidState)
+	}
+
+	if s.registers.Planes&^(1<<PlaneCount-1) != 0 {
+		return fmt.Errorf("%w: planes out of range", ErrInvalidState)
+	}
+
+	if int(s.registers.Cycle) >= vm.cyclesPerFrame {
+		return fmt.Errorf("%w: cycle out of range", ErrInvalidState)
+	}
+
+	// Unmarshal into a copy, so that the generator is left intact on errors
+	rng := *vm.rng
+	if err := rng.UnmarshalBinary(s.rng); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+	*vm.rng = rng
+
+	vm.restoreRegisters(s.registers)
+	copy(vm.memory, s.memory)
+	copy(vm.registers, s.vRegs)
+	copy(vm.stack, s.stack)
+	copy(vm.gfx, s.gfx)
+	copy(vm.keypad, s.keypad)
+	copy(vm.rplFlags, s.rplFlags)
+	copy(vm.audioPattern.Samples[:], s.samples)
+
+	vm.drawFlag = true
+	vm.halted = false
+	vm.rewind.reset(vm.memory)
+	return nil
+}
+
+func (vm *VM) stateRegisters() stateRegisters {
+	return stateRegisters{
+		SP:              vm.sp,
+		PC:              vm.pc,
+		Index:           vm.index,
+		DelayTimer:      vm.delayTimer,
+		SoundTimer:      vm.soundTimer,
+		Hires:           vm.hires,
+		Planes:          vm.planes,
+		HasAudioPattern: vm.hasAudioPattern,
+		Pitch:           vm.audioPattern.Pitch,
+		Cycle:           uint32(vm.cycle),
+	}
+}
+
+func (vm *VM) restoreRegisters(r stateRegisters) {
+	vm.sp = r.SP
+	vm.pc = r.PC
+	vm.index = r.Index
+	vm.delayTimer = r.DelayTimer
+	vm.soundTimer = r.SoundTimer
+	vm.planes = r.Planes
+	vm.hasAudioPattern = r.HasAudioPattern
+	vm.audioPattern.Pitch = r.Pitch
+	vm.cycle = int(r.Cycle)
+
+	vm.hires = r.Hires
+	vm.screenWidth, vm.screenHeight = ScreenWidth, ScreenHeight
+	if vm.hires {
+		vm.screenWidth, vm.screenHeight = HiResScreenWidth, HiResScreenHeight
+	}
+}
+
+func (vm *VM) newState() *state {
+	return &state{
+		memory:   make([]uint8, len(vm.memory)),
+		vRegs:    make([]uint8, len(vm.registers)),
+		stack:    make([]uint16, len(vm.stack)),
+		gfx:      make([]uint8, len(vm.gfx)),
+		keypad:   make([]uint8, len(vm.keypad)),
+		rplFlags: make([]uint8, len(vm.rplFlags)),
+		samples:  make([]uint8, AudioPatternSize),
+		rng:      make([]uint8, rngStateSize),
+	}
+}
+
+// fields returns the state fields in the order they are serialized.
+func (s *state) fields() []any {
+	return []any{
+		&s.registers,
+		s.memory,
+		s.vRegs,
+		s.stack,
+		s.gfx,
+		s.keypad,
+		s.rplFlags,
+		s.samples,
+		s.rng,
+	}
+}
@@ -0,0 +1,87 @@
+package vm_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/kapitanov/chip8vm/internal/headless"
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+func TestStateRestoresRandomAndCycle(t *testing.T) {
+	program := []byte{
+		0x60, 0x0A, // 200: mov v0, 10
+		0xF0, 0x15, // 202: sdelay v0
+		0xC1, 0xFF, // 204: rand v1, ff
+		0x12, 0x04, // 206: jmp 204
+	}
+
+	hal := vm.NewHAL(headless.New(headless.Options{Frames: 10}))
+	step := func(machine *vm.VM, n int) vm.Snapshot {
+		t.Helper()
+		for range n {
+			if err := machine.Step(hal); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return machine.Snapshot()
+	}
+
+	saved := vm.New(program, vm.WithCyclesPerFrame(4), vm.WithSeed(1))
+	saved.Reset()
+	step(saved, 3)
+
+	var buf bytes.Buffer
+	if err := saved.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The frame ends with the jump, then rand runs again
+	want := step(saved, 2)
+
+	loaded := vm.New(program, vm.WithCyclesPerFrame(4), vm.WithSeed(2))
+	if err := loaded.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := step(loaded, 1); got.DelayTimer != want.DelayTimer {
+		t.Errorf("delay timer = %d after the frame, want %d", got.DelayTimer, want.DelayTimer)
+	}
+	if got := step(loaded, 1); got.Registers[1] != want.Registers[1] {
+		t.Errorf("v1 = 0x%02x, want 0x%02x", got.Registers[1], want.Registers[1])
+	}
+}
+
+func TestLoadStateRejectsRegistersOutOfRange(t *testing.T) {
+	// The registers follow the magic, the version, the ROM hash and the platform
+	const registers = 4 + 2 + 20 + 1
+
+	tests := []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{name: "stack pointer", offset: registers, value: []byte{0x00, 0x11}},
+		{name: "planes", offset: registers + 9, value: []byte{0x04}},
+		{name: "cycle", offset: registers + 12, value: []byte{0x00, 0x00, 0x00, 0x04}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := vm.New([]byte{0x12, 0x00}, vm.WithCyclesPerFrame(4))
+			machine.Reset()
+
+			var buf bytes.Buffer
+			if err := machine.SaveState(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			state := buf.Bytes()
+			copy(state[tt.offset:], tt.value)
+			if err := machine.LoadState(bytes.NewReader(state)); !errors.Is(err, vm.ErrInvalidState) {
+				t.Errorf("LoadState() = %v, want %v", err, vm.ErrInvalidState)
+			}
+		})
+	}
+}
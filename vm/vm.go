@@ -0,0 +1,576 @@
+package vm
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	MemorySize       = 4096
+	XOChipMemorySize = 65536
+	StackSize        = 16
+	RegisterCount    = 16
+	ScreenWidth      = 64
+	ScreenHeight     = 32
+	KeyCount         = 16
+	RPLFlagCount     = 8
+
+	HiResScreenWidth  = 128
+	HiResScreenHeight = 64
+
+	PlaneCount       = 2
+	AudioPatternSize = 16
+
+	ProgramStart    = uint16(0x200)
+	InstructionSize = 2
+
+	FrameRate             = 60
+	DefaultCyclesPerFrame = 10
+)
+
+type Config struct {
+	CyclesPerFrame int         // Instructions executed per frame, DefaultCyclesPerFrame if zero
+	Quirks         Quirks      // Interpretation of ambiguous instructions, the platform defaults if zero
+	Platform       Platform    // Emulated machine
+	RewindFrames   int         // Number of recent frames kept for rewinding, disabled if zero
+	Seed           uint64      // Seed of the random number generator, the same seed gives the same numbers
+	FaultPolicy    FaultPolicy // What to do on a fault, FaultHalt if zero
+}
+
+// VM is a CHIP-8 machine. Run and Step must be called from a single goroutine,
+// Pause, Resume, StepFrame, Reset, Rewind, Snapshot, SaveState and LoadState
+// may be called from any goroutine. Other accessors aren't synchronized.
+type VM struct {
+	mu sync.Mutex // Guards the state while instructions are executed
+
+	memory    []uint8 // Memory (4k, 64k for XO-CHIP)
+	registers []uint8 // V registers (V0-VF)
+
+	stack []uint16 // Stack
+	sp    uint16   // Stack pointer
+
+	pc    uint16 // Program counter
+	index uint16 // Index register
+
+	delayTimer uint8 // Delay timer
+	soundTimer uint8 // Sound timer
+
+	gfx          []uint8 // Graphics buffer
+	screenWidth  int     // Current screen width
+	screenHeight int     // Current screen height
+	hires        bool    // Indicates high resolution (128x64) mode
+	keypad       []uint8 // Keypad
+	planes       uint8   // Bitmask of the planes selected for drawing (XO-CHIP)
+	drawFlag     bool    // Indicates a draw has occurred
+
+	audioPattern    AudioPattern // Audio pattern buffer and pitch (XO-CHIP)
+	hasAudioPattern bool         // Indicates the audio pattern buffer has been loaded
+	buzzer          bool         // Indicates the buzzer sounds in the frame that has just ended
+
+	screen  []uint8      // Copy of the screen passed to Display, owned by Run or Step
+	pattern AudioPattern // Copy of the audio pattern passed to Audio, owned by Run or Step
+
+	rplFlags []uint8 // SUPER-CHIP RPL user flags, preserved across resets
+
+	keyDownFunc func(Key) // keyDown bound once, so that reading input doesn't allocate
+	keyUpFunc   func(Key) // keyUp bound once
+
+	cyclesPerFrame int          // Instructions executed per frame
+	quirks         Quirks       // Interpretation of ambiguous instructions
+	platform       Platform     // Emulated machine
+	opcodes        *decodeTable // Opcodes decoded for the platform
+	faultPolicy    FaultPolicy  // What to do on a fault
+
+	cycle int // Number of instructions executed in the current frame
+
+	memoryWatch func(addr uint16, size int, write bool) // Called on memory accesses of instructions
+	trace       bool                                    // Indicates executed instructions are logged, checked on reset
+
+	rewind  *rewindBuffer // Recent frames for rewinding, nil if disabled
+	rewound bool          // Indicates the VM has been rewound and the next frame must not be executed
+
+	seed uint64    // Seed of the random number generator
+	rng  *rand.PCG // Random number generator, reseeded on reset
+
+	halted        bool // Indicates the program has stopped by itself
+	paused        bool // Indicates frames are only run by StepFrame
+	pendingFrames int  // Number of frames requested by StepFrame
+
+	program []byte
+	romHash [sha1.Size]byte // SHA-1 hash of the program
+}
+
+// New creates a VM running a program, e.g.
+//
+//	machine := vm.New(rom, vm.WithPlatform(vm.PlatformXOChip), vm.WithSeed(42))
+func New(program []byte, opts ...Option) *VM {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	config := o.config
+	if !o.quirks {
+		config.Quirks = config.Platform.DefaultQuirks()
+	}
+
+	cyclesPerFrame := config.CyclesPerFrame
+	if cyclesPerFrame <= 0 {
+		cyclesPerFrame = DefaultCyclesPerFrame
+	}
+
+	memorySize := config.Platform.MemorySize()
+
+	vm := &VM{
+		memory:    make([]uint8, memorySize),
+		registers: make([]uint8, RegisterCount),
+		stack:     make([]uint16, StackSize),
+		gfx:       make([]uint8, HiResScreenWidth*HiResScreenHeight),
+		screen:    make([]uint8, HiResScreenWidth*HiResScreenHeight),
+		keypad:    make([]uint8, KeyCount),
+		rplFlags:  make([]uint8, RPLFlagCount),
+		program:   program,
+		romHash:   sha1.Sum(program),
+
+		cyclesPerFrame: cyclesPerFrame,
+		quirks:         config.Quirks,
+		platform:       config.Platform,
+		opcodes:        config.Platform.opcodes(),
+		faultPolicy:    config.FaultPolicy,
+
+		rewind: newRewindBuffer(config.RewindFrames, memorySize),
+
+		seed: config.Seed,
+		rng:  rand.NewPCG(config.Seed, config.Seed),
+	}
+	vm.keyDownFunc, vm.keyUpFunc = vm.keyDown, vm.keyUp
+
+	return vm
+}
+
+// Display presents the screen.
+type Display interface {
+	Draw(fb Framebuffer) error
+}
+
+// Audio plays the sound. It's called once per frame, including the frames
+// the VM is paused, halted or rewound in, on indicates whether the buzzer
+// sounds during the frame. The pattern is nil unless an XO-CHIP audio
+// pattern has been loaded.
+type Audio interface {
+	Sound(on bool, pattern *AudioPattern) error
+}
+
+// Input reports key presses and releases.
+type Input interface {
+	ReadInput(keyDown func(Key), keyUp func(Key)) error
+}
+
+// Clock paces frames.
+type Clock interface {
+	WaitForNextFrame() error
+}
+
+// HAL is a set of devices the VM runs on, each one may come from a different
+// implementation. Missing devices are skipped: nothing is drawn or played,
+// no keys are pressed and frames are not paced. Devices are called without
+// the VM locked, so they may pause, rewind or take snapshots of the VM.
+type HAL struct {
+	Display Display
+	Audio   Audio
+	Input   Input
+	Clock   Clock
+}
+
+// NewHAL returns a HAL with all devices provided by d.
+func NewHAL(d interface {
+	Display
+	Audio
+	Input
+	Clock
+}) HAL {
+	return HAL{Display: d, Audio: d, Input: d, Clock: d}
+}
+
+func (hal HAL) Draw(fb Framebuffer) error {
+	if hal.Display == nil {
+		return nil
+	}
+
+	return hal.Display.Draw(fb)
+}
+
+func (hal HAL) Sound(on bool, pattern *AudioPattern) error {
+	if hal.Audio == nil {
+		return nil
+	}
+
+	return hal.Audio.Sound(on, pattern)
+}
+
+func (hal HAL) ReadInput(keyDown func(Key), keyUp func(Key)) error {
+	if hal.Input == nil {
+		return nil
+	}
+
+	return hal.Input.ReadInput(keyDown, keyUp)
+}
+
+func (hal HAL) WaitForNextFrame() error {
+	if hal.Clock == nil {
+		return nil
+	}
+
+	return hal.Clock.WaitForNextFrame()
+}
+
+type Key uint8
+
+const (
+	Key0 = Key(iota)
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+	KeyA
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+)
+
+// Run resets the VM and runs the program until the HAL returns an error,
+// the program faults or ctx is done. A program that has stopped by itself
+// is kept on the screen until the VM is reset.
+func (vm *VM) Run(ctx context.Context, hal HAL) error {
+	vm.Reset()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var err error
+		if vm.nextFrame() {
+			err = vm.runFrame(hal)
+		} else {
+			err = vm.idleFrame(hal)
+		}
+
+		switch {
+		case errors.Is(err, ErrInfiniteLoop):
+			slog.Info("program looped")
+			vm.halt()
+
+		case errors.Is(err, ErrExit):
+			slog.Info("program exited")
+			vm.halt()
+
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// idleFrame keeps the HAL running while the VM is paused or halted.
+func (vm *VM) idleFrame(hal HAL) error {
+	// The stopped program can't turn the buzzer off
+	if err := hal.Sound(false, nil); err != nil {
+		return err
+	}
+
+	return vm.endFrame(hal)
+}
+
+// runFrame executes a single 60 Hz frame: a batch of instructions followed
+// by a timer tick, input polling and waiting for the next frame to begin.
+func (vm *VM) runFrame(hal HAL) error {
+	if err := vm.executeFrame(hal); err != nil {
+		return err
+	}
+
+	return vm.endFrame(hal)
+}
+
+// executeFrame executes the instructions left in the current frame and
+// ticks the timers. The lock is released to present the screen whenever
+// it changes and the sound at the end of the frame.
+func (vm *VM) executeFrame(hal HAL) error {
+	for {
+		vm.mu.Lock()
+		last, err := vm.executeBatch()
+		var out output
+		if err == nil {
+			out = vm.takeOutput(last)
+		}
+		vm.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		if err = out.present(hal); err != nil || last {
+			return err
+		}
+	}
+}
+
+// executeBatch executes instructions until one of them changes the screen
+// or the frame ends, returns true at the end of the frame.
+func (vm *VM) executeBatch() (bool, error) {
+	if vm.rewound {
+		// Only present the frame the VM has been rewound to, the buzzer
+		// is silent as the timers don't tick
+		vm.rewound = false
+		vm.buzzer = false
+		return true, nil
+	}
+
+	for {
+		last, err := vm.executeInstruction()
+		if err != nil || last || vm.drawFlag {
+			return last, err
+		}
+	}
+}
+
+// Step executes a single instruction. After the last instruction of a frame,
+// it also ticks the timers, polls input and waits for the next frame to begin.
+func (vm *VM) Step(hal HAL) error {
+	vm.mu.Lock()
+	last, err := vm.executeInstruction()
+	var out output
+	if err == nil {
+		out = vm.takeOutput(last)
+	}
+	vm.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err = out.present(hal); err != nil || !last {
+		return err
+	}
+
+	return vm.endFrame(hal)
+}
+
+// executeInstruction executes a single instruction, ticks the timers after
+// the last instruction of a frame and returns true then.
+func (vm *VM) executeInstruction() (bool, error) {
+	if vm.cycle == 0 {
+		vm.rewound = false
+		vm.rewind.capture(vm)
+	}
+
+	if err := vm.step(); err != nil {
+		return false, err
+	}
+
+	vm.cycle++
+	if vm.cycle < vm.cyclesPerFrame {
+		return false, nil
+	}
+	vm.cycle = 0
+
+	vm.updateTimers()
+	return true, nil
+}
+
+// output is what the devices present. It's taken while the lock is held
+// and presented once it's released, so that devices may call the VM.
+type output struct {
+	draw    bool
+	fb      Framebuffer
+	sound   bool // Indicates Sound is called, once per frame
+	on      bool
+	pattern *AudioPattern
+}
+
+// takeOutput copies the screen if it has changed since it was last taken
+// and, at the end of a frame, the state of the buzzer.
+func (vm *VM) takeOutput(frameEnd bool) output {
+	var out output
+
+	if vm.drawFlag {
+		fb := vm.framebuffer()
+		fb.Pixels = vm.screen[:copy(vm.screen, fb.Pixels)]
+		out.draw, out.fb = true, fb
+		vm.drawFlag = false
+	}
+
+	if frameEnd {
+		out.sound, out.on = true, vm.buzzer
+		if vm.hasAudioPattern {
+			vm.pattern = vm.audioPattern
+			out.pattern = &vm.pattern
+		}
+	}
+
+	return out
+}
+
+// present draws the screen and plays the sound, the lock must not be held.
+func (out *output) present(hal HAL) error {
+	if out.draw {
+		if err := hal.Draw(out.fb); err != nil {
+			return err
+		}
+	}
+
+	if out.sound {
+		return hal.Sound(out.on, out.pattern)
+	}
+
+	return nil
+}
+
+// endFrame polls input and waits for the next frame to begin. The lock
+// isn't held, so that HAL callbacks may save states or rewind the VM.
+func (vm *VM) endFrame(hal HAL) error {
+	if err := hal.ReadInput(vm.keyDownFunc, vm.keyUpFunc); err != nil {
+		return err
+	}
+
+	if err := hal.WaitForNextFrame(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reset restarts the program from the beginning, clearing everything but
+// the SUPER-CHIP RPL user flags. A paused VM stays paused.
+func (vm *VM) Reset() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	vm.initialize()
+}
+
+// SetMemoryWatch installs a function called whenever an instruction reads
+// or writes size bytes of memory starting at addr. Instruction fetches are
+// not reported. Pass nil to remove it.
+func (vm *VM) SetMemoryWatch(fn func(addr uint16, size int, write bool)) {
+	vm.memoryWatch = fn
+}
+
+func (vm *VM) watchMemory(addr uint16, size int, write bool) {
+	if vm.memoryWatch != nil {
+		vm.memoryWatch(addr, size, write)
+	}
+}
+
+func (vm *VM) initialize() {
+	vm.cycle = 0
+	vm.pc = ProgramStart
+	vm.index = 0
+	vm.sp = 0
+
+	// Clear the display and switch to low resolution mode
+	vm.planes = 0x01
+	vm.setResolution(false)
+
+	// Clear the stack, keypad, and V registers
+	slog.Debug("clear stack", "n", len(vm.stack))
+	for i := range vm.stack {
+		vm.stack[i] = 0
+	}
+
+	slog.Debug("clear keypad", "n", len(vm.keypad))
+	for i := range vm.keypad {
+		vm.keypad[i] = 0
+	}
+
+	slog.Debug("clear registers", "n", len(vm.registers))
+	for i := range vm.registers {
+		vm.registers[i] = 0
+	}
+
+	// Clear memory
+	slog.Debug("clear memory", "n", len(vm.memory))
+	for i := range vm.memory {
+		vm.memory[i] = 0
+	}
+
+	// Load font sets into memory
+	slog.Debug("load font", "at", fmt.Sprintf("0x%04x", fontAddr), "n", len(chip8Font))
+	copy(vm.memory[fontAddr:], chip8Font)
+
+	slog.Debug("load big font", "at", fmt.Sprintf("0x%04x", bigFontAddr), "n", len(superChipFont))
+	copy(vm.memory[bigFontAddr:], superChipFont)
+
+	// Load program into memory
+	slog.Info("load program", "at", fmt.Sprintf("0x%04x", ProgramStart), "n", len(vm.program))
+	copy(vm.memory[ProgramStart:], vm.program)
+
+	// Drop rewind history
+	vm.rewind.reset(vm.memory)
+	vm.rewound = false
+	vm.halted = false
+
+	// Reset timers and audio
+	vm.delayTimer = 0
+	vm.soundTimer = 0
+	vm.audioPattern = AudioPattern{Pitch: 64}
+	vm.hasAudioPattern = false
+
+	// Restart the sequence of random numbers
+	vm.rng.Seed(vm.seed, vm.seed)
+
+	// Checking the log level is too slow to do it for every instruction
+	vm.trace = slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
+
+func (vm *VM) keyDown(key Key) {
+	vm.mu.Lock()
+	vm.keypad[int(key)] = 1
+	vm.mu.Unlock()
+}
+
+func (vm *VM) keyUp(key Key) {
+	vm.mu.Lock()
+	vm.keypad[int(key)] = 0
+	vm.mu.Unlock()
+}
+
+func (vm *VM) step() error {
+	if err := vm.checkMemory(int(vm.pc), InstructionSize); err != nil {
+		return err
+	}
+
+	return vm.executeOpcode(vm.fetchOpcode())
+}
+
+// updateTimers decrements the delay and sound timers, it is called once per frame.
+func (vm *VM) updateTimers() {
+	if vm.delayTimer > 0 {
+		vm.delayTimer--
+	}
+
+	// The buzzer sounds for as long as the sound timer is non-zero
+	vm.buzzer = vm.soundTimer > 0
+	if vm.soundTimer > 0 {
+		vm.soundTimer--
+	}
+}
+
+func (vm *VM) fetchOpcode() uint16 {
+	hi := vm.readMemory(int(vm.pc))
+	lo := vm.readMemory(int(vm.pc) + 1)
+
+	opcode := uint16(hi)<<8 | uint16(lo) // Op code is two bytes
+	return opcode
+}
@@ -0,0 +1,118 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kapitanov/chip8vm/vm"
+)
+
+var errDone = errors.New("done")
+
+// soundCounter counts the calls of Sound.
+type soundCounter int
+
+func (c *soundCounter) Sound(bool, *vm.AudioPattern) error {
+	*c++
+	return nil
+}
+
+// displayFunc calls a function on every draw.
+type displayFunc func(vm.Framebuffer) error
+
+func (f displayFunc) Draw(fb vm.Framebuffer) error {
+	return f(fb)
+}
+
+// audioFunc calls a function on every frame.
+type audioFunc func(on bool, pattern *vm.AudioPattern) error
+
+func (f audioFunc) Sound(on bool, pattern *vm.AudioPattern) error {
+	return f(on, pattern)
+}
+
+// clockFunc calls a function at the end of every frame.
+type clockFunc func() error
+
+func (f clockFunc) WaitForNextFrame() error {
+	return f()
+}
+
+func TestRunSoundsOncePerFrame(t *testing.T) {
+	program := []byte{
+		0x60, 0x05, // 200: mov v0, 5
+		0xF0, 0x18, // 202: ssound v0
+		0x12, 0x00, // 204: jmp 200
+	}
+
+	machine := vm.New(program, vm.WithCyclesPerFrame(3), vm.WithRewind(10))
+
+	var sounds soundCounter
+	frames := 0
+	clock := clockFunc(func() error {
+		frames++
+		switch frames {
+		case 4:
+			machine.Rewind(2)
+		case 6:
+			machine.Pause()
+		case 8:
+			return errDone
+		}
+		return nil
+	})
+
+	if err := machine.Run(context.Background(), vm.HAL{Audio: &sounds, Clock: clock}); !errors.Is(err, errDone) {
+		t.Fatalf("Run() = %v, want %v", err, errDone)
+	}
+
+	if int(sounds) != frames {
+		t.Errorf("Sound called %d times in %d frames", sounds, frames)
+	}
+}
+
+func TestRunLetsDevicesCallVM(t *testing.T) {
+	program := []byte{
+		0x00, 0xE0, // 200: cls
+		0x12, 0x00, // 202: jmp 200
+	}
+
+	machine := vm.New(program, vm.WithCyclesPerFrame(4))
+
+	draws, frames := 0, 0
+	hal := vm.HAL{
+		Display: displayFunc(func(vm.Framebuffer) error {
+			draws++
+			machine.Snapshot()
+			return nil
+		}),
+		Audio: audioFunc(func(bool, *vm.AudioPattern) error {
+			machine.Paused()
+			return nil
+		}),
+		Clock: clockFunc(func() error {
+			if frames++; frames == 3 {
+				return errDone
+			}
+			return nil
+		}),
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- machine.Run(context.Background(), hal) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errDone) {
+			t.Fatalf("Run() = %v, want %v", err, errDone)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() deadlocked")
+	}
+
+	if draws != 6 {
+		t.Errorf("Draw called %d times, want 6", draws)
+	}
+}